@@ -0,0 +1,67 @@
+package core
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// serverSetPaths are field paths that are set by the API server on every write or
+// are not owned by the reconciler, they are left out of reported changes and patches.
+var serverSetPaths = []string{
+	"apiVersion",
+	"kind",
+	"metadata.uid",
+	"metadata.creationTimestamp",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.managedFields",
+	"status",
+}
+
+// apply reconciles desired using a server-side apply patch. found holds the live
+// object as it was before the patch, if it exists.
+func apply[T client.Object](ctx context.Context, r client.Client, desired, found T, exists bool, o *options) (Result, error) {
+	log := o.logger(ctx)
+	kind := kindOf(desired)
+	key := client.ObjectKeyFromObject(desired)
+
+	// Apply patches must identify the kind they are for and must not
+	// carry fields that are only set by the server.
+	gvk, err := apiutil.GVKForObject(desired, r.Scheme())
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "unable to determine the kind of %s %s", kind, key)
+	}
+	desired.GetObjectKind().SetGroupVersionKind(gvk)
+	desired.SetResourceVersion("")
+	desired.SetManagedFields(nil)
+	if err := o.setOwner(desired); err != nil {
+		return Result{}, errors.Wrapf(err, "unable to set owner of %s %s", kind, key)
+	}
+
+	patchOpts := []client.PatchOption{client.FieldOwner(o.fieldManager)}
+	if o.forceOwnership {
+		patchOpts = append(patchOpts, client.ForceOwnership)
+	}
+	if o.dryRun {
+		patchOpts = append(patchOpts, client.DryRunAll)
+	}
+
+	log.Info("Applying "+kind, append(keysAndValues(desired), "fieldManager", o.fieldManager)...)
+	if err := r.Patch(ctx, desired, client.Apply, patchOpts...); err != nil {
+		log.Error(err, "Unable to apply "+kind)
+		return Result{}, errors.Wrapf(err, "unable to apply %s %s", kind, key)
+	}
+
+	if !exists {
+		return o.planned(Result{Operation: OperationResultCreated, Object: desired}, nil)
+	}
+	changes := Diff("", found, desired).Without(serverSetPaths...).Redact(redactedPaths[kind]...)
+	if len(changes) == 0 {
+		return o.planned(Result{Operation: OperationResultUnchanged, Object: desired}, found)
+	}
+	return o.planned(Result{Operation: OperationResultUpdated, Changes: changes, Object: desired}, found)
+}
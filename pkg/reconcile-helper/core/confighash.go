@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ConfigHashAnnotation is the pod template annotation WithConfigHash stores the hash of
+// the ConfigMaps and Secrets referenced by the pod template in.
+const ConfigHashAnnotation = "reconcile.plural.sh/config-hash"
+
+// WithConfigHash stamps the hash of all ConfigMaps and Secrets referenced by the pod template
+// of a Deployment or StatefulSet into its ConfigHashAnnotation, see ConfigHash. A change of
+// one of them thereby changes the pod template and triggers a rolling update.
+// It has no effect on other kinds.
+func WithConfigHash() Option {
+	return withPrepare(func(ctx context.Context, r client.Client, desired, _ client.Object) error {
+		var template *corev1.PodTemplateSpec
+		switch obj := desired.(type) {
+		case *appsv1.Deployment:
+			template = &obj.Spec.Template
+		case *appsv1.StatefulSet:
+			template = &obj.Spec.Template
+		default:
+			return nil
+		}
+
+		hash, err := ConfigHash(ctx, r, desired.GetNamespace(), &template.Spec)
+		if err != nil {
+			return err
+		}
+		annotations := make(map[string]string, len(template.Annotations)+1)
+		for k, v := range template.Annotations {
+			annotations[k] = v
+		}
+		annotations[ConfigHashAnnotation] = hash
+		template.Annotations = annotations
+		return nil
+	})
+}
+
+// configContent is the hashed content of a referenced ConfigMap or Secret.
+type configContent struct {
+	Kind            string            `json:"kind"`
+	Name            string            `json:"name"`
+	Missing         bool              `json:"missing,omitempty"`
+	UID             types.UID         `json:"uid,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Data            map[string]string `json:"data,omitempty"`
+	BinaryData      map[string][]byte `json:"binaryData,omitempty"`
+}
+
+// ConfigHash returns a stable hash of all ConfigMaps and Secrets in namespace that spec
+// references through volumes, projected volumes, env and envFrom of its containers and init
+// containers. ConfigMaps are hashed by their content. Secrets are hashed by their UID and
+// resourceVersion instead, as the hash is readable by anyone who can read the pod template
+// and would allow guessing low-entropy values; any update of a Secret changes it. References
+// to objects that do not exist, e.g. optional ones, are part of the hash as well, so creating
+// the object later changes it.
+func ConfigHash(ctx context.Context, r client.Client, namespace string, spec *corev1.PodSpec) (string, error) {
+	configMaps, secrets := configReferences(spec)
+
+	contents := make([]configContent, 0, len(configMaps)+len(secrets))
+	for _, name := range configMaps {
+		content := configContent{Kind: "ConfigMap", Name: name}
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, configMap); err != nil {
+			if !apierrs.IsNotFound(err) {
+				return "", errors.Wrapf(err, "unable to get ConfigMap %s/%s", namespace, name)
+			}
+			content.Missing = true
+		}
+		content.Data, content.BinaryData = configMap.Data, configMap.BinaryData
+		contents = append(contents, content)
+	}
+	for _, name := range secrets {
+		content := configContent{Kind: "Secret", Name: name}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+			if !apierrs.IsNotFound(err) {
+				return "", errors.Wrapf(err, "unable to get Secret %s/%s", namespace, name)
+			}
+			content.Missing = true
+		}
+		content.UID, content.ResourceVersion = secret.UID, secret.ResourceVersion
+		contents = append(contents, content)
+	}
+
+	// Maps are marshalled with sorted keys, which keeps the hash stable.
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to hash config")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// configReferences returns the sorted names of the ConfigMaps and Secrets referenced by spec.
+func configReferences(spec *corev1.PodSpec) ([]string, []string) {
+	configMaps, secrets := map[string]bool{}, map[string]bool{}
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			configMaps[volume.ConfigMap.Name] = true
+		}
+		if volume.Secret != nil {
+			secrets[volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMaps[source.ConfigMap.Name] = true
+				}
+				if source.Secret != nil {
+					secrets[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, container := range containers {
+			for _, env := range container.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+				if env.ValueFrom.ConfigMapKeyRef != nil {
+					configMaps[env.ValueFrom.ConfigMapKeyRef.Name] = true
+				}
+				if env.ValueFrom.SecretKeyRef != nil {
+					secrets[env.ValueFrom.SecretKeyRef.Name] = true
+				}
+			}
+			for _, envFrom := range container.EnvFrom {
+				if envFrom.ConfigMapRef != nil {
+					configMaps[envFrom.ConfigMapRef.Name] = true
+				}
+				if envFrom.SecretRef != nil {
+					secrets[envFrom.SecretRef.Name] = true
+				}
+			}
+		}
+	}
+	return sortedKeys(configMaps), sortedKeys(secrets)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
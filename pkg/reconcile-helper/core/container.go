@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// InjectedContainers lists the names of containers that are commonly injected into pod
+// templates by mutating webhooks, such as service mesh sidecars. When reconciling the
+// containers of a pod template they are kept on the live object, together with the volumes
+// they mount, unless the desired object declares a container with the same name and thereby owns it.
+var InjectedContainers = []string{
+	"istio-proxy",
+	"istio-init",
+	"istio-validation",
+	"linkerd-proxy",
+	"linkerd-init",
+	"vault-agent",
+	"vault-agent-init",
+}
+
+// copyContainers copies the containers or init containers of a pod template, matching
+// them by name. Containers missing from to are added, containers that are no longer wanted
+// are removed unless they are listed in InjectedContainers, and the owned fields of the
+// remaining containers are copied while the fields that are not owned keep their live values.
+// As init containers run in order, a change in order is also reported. from is expected
+// to have the API server defaults applied, see defaultPodSpec.
+// Returns true if the containers copied from don't match to.
+func copyContainers(log logr.Logger, kind, path string, from []corev1.Container, to *[]corev1.Container) bool {
+	existing := make(map[string]corev1.Container, len(*to))
+	for _, container := range *to {
+		existing[container.Name] = container
+	}
+	wanted := make(map[string]bool, len(from))
+	for _, container := range from {
+		wanted[container.Name] = true
+	}
+
+	requireUpdate := false
+	var changes Changes
+	containers := make([]corev1.Container, 0, len(from))
+	for i := range from {
+		want := &from[i]
+		containerPath := fmt.Sprintf("%s[name=%s]", path, want.Name)
+		container, ok := existing[want.Name]
+		if !ok {
+			changes = append(changes, Change{Path: containerPath, To: *want})
+			containers = append(containers, *want)
+			continue
+		}
+		requireUpdate = copyContainerFields(log, kind, containerPath, want, &container) || requireUpdate
+		containers = append(containers, container)
+	}
+
+	// Keep injected containers at their original position so they don't cause a reorder.
+	for i, container := range *to {
+		if wanted[container.Name] {
+			continue
+		}
+		if !isInjectedContainer(container.Name) {
+			changes = append(changes, Change{Path: fmt.Sprintf("%s[name=%s]", path, container.Name), From: container})
+			continue
+		}
+		position := i
+		if position > len(containers) {
+			position = len(containers)
+		}
+		containers = append(containers[:position], append([]corev1.Container{container}, containers[position:]...)...)
+	}
+
+	if len(changes) == 0 && !reflect.DeepEqual(containerNames(*to), containerNames(containers)) {
+		changes = append(changes, Change{Path: path, From: containerNames(*to), To: containerNames(containers)})
+	}
+	requireUpdate = logChanges(log, kind, path, changes) || requireUpdate
+
+	*to = containers
+	return requireUpdate
+}
+
+// copyContainerFields copies the owned fields from one container of a pod template to another.
+// path is the path of the container within kind, it prefixes the logged changes.
+// Returns true if the fields copied from don't match to.
+func copyContainerFields(log logr.Logger, kind, path string, from, to *corev1.Container) bool {
+	requireUpdate := false
+	requireUpdate = copyField(log, kind, path+".image", &to.Image, from.Image) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".imagePullPolicy", &to.ImagePullPolicy, from.ImagePullPolicy) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".command", &to.Command, from.Command) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".args", &to.Args, from.Args) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".workingDir", &to.WorkingDir, from.WorkingDir) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".ports", &to.Ports, from.Ports) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".env", &to.Env, from.Env) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".envFrom", &to.EnvFrom, from.EnvFrom) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".resources", &to.Resources, from.Resources) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".volumeMounts", &to.VolumeMounts, from.VolumeMounts) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".volumeDevices", &to.VolumeDevices, from.VolumeDevices) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".livenessProbe", &to.LivenessProbe, from.LivenessProbe) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".readinessProbe", &to.ReadinessProbe, from.ReadinessProbe) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".startupProbe", &to.StartupProbe, from.StartupProbe) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".lifecycle", &to.Lifecycle, from.Lifecycle) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".terminationMessagePath", &to.TerminationMessagePath, from.TerminationMessagePath) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".terminationMessagePolicy", &to.TerminationMessagePolicy, from.TerminationMessagePolicy) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".securityContext", &to.SecurityContext, from.SecurityContext) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".stdin", &to.Stdin, from.Stdin) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".stdinOnce", &to.StdinOnce, from.StdinOnce) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".tty", &to.TTY, from.TTY) || requireUpdate
+	// RestartPolicy is only set on init containers, "Always" makes them native sidecars.
+	requireUpdate = copyField(log, kind, path+".restartPolicy", &to.RestartPolicy, from.RestartPolicy) || requireUpdate
+	// ResizePolicy is not copied, the API server defaults it when in-place pod
+	// resizing is enabled so copying it would cause a difference on every reconcile.
+	return requireUpdate
+}
+
+func isInjectedContainer(name string) bool {
+	for _, injected := range InjectedContainers {
+		if name == injected {
+			return true
+		}
+	}
+	return false
+}
+
+func containerNames(containers []corev1.Container) []string {
+	names := make([]string, 0, len(containers))
+	for _, container := range containers {
+		names = append(names, container.Name)
+	}
+	return names
+}
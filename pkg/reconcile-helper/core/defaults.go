@@ -0,0 +1,379 @@
+package core
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+)
+
+// The defaulting functions in this file mirror the defaults the API server applies
+// (see k8s.io/kubernetes/pkg/apis/*/v1/defaults.go) to the fields reconciled by
+// this package. Applying them to the desired object before comparing it with the
+// live object prevents the defaulted fields from showing up as differences, which
+// would otherwise trigger an update on every reconcile.
+
+// defaultDeployment sets the fields of a Deployment that are defaulted by the API server.
+func defaultDeployment(d *appsv1.Deployment) {
+	if d.Spec.Replicas == nil {
+		d.Spec.Replicas = pointer.Int32(1)
+	}
+	if d.Spec.Strategy.Type == "" {
+		d.Spec.Strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+	}
+	if d.Spec.Strategy.Type == appsv1.RollingUpdateDeploymentStrategyType {
+		if d.Spec.Strategy.RollingUpdate == nil {
+			d.Spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{}
+		}
+		if d.Spec.Strategy.RollingUpdate.MaxUnavailable == nil {
+			maxUnavailable := intstr.FromString("25%")
+			d.Spec.Strategy.RollingUpdate.MaxUnavailable = &maxUnavailable
+		}
+		if d.Spec.Strategy.RollingUpdate.MaxSurge == nil {
+			maxSurge := intstr.FromString("25%")
+			d.Spec.Strategy.RollingUpdate.MaxSurge = &maxSurge
+		}
+	}
+	if d.Spec.RevisionHistoryLimit == nil {
+		d.Spec.RevisionHistoryLimit = pointer.Int32(10)
+	}
+	if d.Spec.ProgressDeadlineSeconds == nil {
+		d.Spec.ProgressDeadlineSeconds = pointer.Int32(600)
+	}
+	defaultPodSpec(&d.Spec.Template.Spec)
+}
+
+// defaultStatefulSet sets the fields of a StatefulSet that are defaulted by the API server.
+func defaultStatefulSet(s *appsv1.StatefulSet) {
+	if s.Spec.Replicas == nil {
+		s.Spec.Replicas = pointer.Int32(1)
+	}
+	if s.Spec.PodManagementPolicy == "" {
+		s.Spec.PodManagementPolicy = appsv1.OrderedReadyPodManagement
+	}
+	if s.Spec.UpdateStrategy.Type == "" {
+		s.Spec.UpdateStrategy.Type = appsv1.RollingUpdateStatefulSetStrategyType
+	}
+	if s.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType {
+		if s.Spec.UpdateStrategy.RollingUpdate == nil {
+			s.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{}
+		}
+		if s.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+			s.Spec.UpdateStrategy.RollingUpdate.Partition = pointer.Int32(0)
+		}
+	}
+	if s.Spec.RevisionHistoryLimit == nil {
+		s.Spec.RevisionHistoryLimit = pointer.Int32(10)
+	}
+	for i := range s.Spec.VolumeClaimTemplates {
+		defaultPersistentVolumeClaimSpec(&s.Spec.VolumeClaimTemplates[i].Spec)
+	}
+	defaultPodSpec(&s.Spec.Template.Spec)
+}
+
+// defaultPodSpec sets the fields of a pod template spec that are defaulted by the API server.
+func defaultPodSpec(spec *corev1.PodSpec) {
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = corev1.RestartPolicyAlways
+	}
+	if spec.DNSPolicy == "" {
+		spec.DNSPolicy = corev1.DNSClusterFirst
+	}
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	if spec.TerminationGracePeriodSeconds == nil {
+		spec.TerminationGracePeriodSeconds = pointer.Int64(corev1.DefaultTerminationGracePeriodSeconds)
+	}
+	if spec.SchedulerName == "" {
+		spec.SchedulerName = corev1.DefaultSchedulerName
+	}
+	for i := range spec.Volumes {
+		defaultVolume(&spec.Volumes[i])
+	}
+	for i := range spec.InitContainers {
+		defaultContainer(&spec.InitContainers[i], spec.HostNetwork)
+	}
+	for i := range spec.Containers {
+		defaultContainer(&spec.Containers[i], spec.HostNetwork)
+	}
+}
+
+// defaultVolume sets the fields of a pod volume that are defaulted by the API server.
+func defaultVolume(v *corev1.Volume) {
+	if v.VolumeSource == (corev1.VolumeSource{}) {
+		v.EmptyDir = &corev1.EmptyDirVolumeSource{}
+	}
+	switch {
+	case v.ConfigMap != nil:
+		if v.ConfigMap.DefaultMode == nil {
+			v.ConfigMap.DefaultMode = pointer.Int32(corev1.ConfigMapVolumeSourceDefaultMode)
+		}
+	case v.Secret != nil:
+		if v.Secret.DefaultMode == nil {
+			v.Secret.DefaultMode = pointer.Int32(corev1.SecretVolumeSourceDefaultMode)
+		}
+	case v.Projected != nil:
+		if v.Projected.DefaultMode == nil {
+			v.Projected.DefaultMode = pointer.Int32(corev1.ProjectedVolumeSourceDefaultMode)
+		}
+		for i := range v.Projected.Sources {
+			if downwardAPI := v.Projected.Sources[i].DownwardAPI; downwardAPI != nil {
+				for j := range downwardAPI.Items {
+					defaultObjectFieldSelector(downwardAPI.Items[j].FieldRef)
+				}
+			}
+			if token := v.Projected.Sources[i].ServiceAccountToken; token != nil && token.ExpirationSeconds == nil {
+				token.ExpirationSeconds = pointer.Int64(60 * 60)
+			}
+		}
+	case v.DownwardAPI != nil:
+		if v.DownwardAPI.DefaultMode == nil {
+			v.DownwardAPI.DefaultMode = pointer.Int32(corev1.DownwardAPIVolumeSourceDefaultMode)
+		}
+		for i := range v.DownwardAPI.Items {
+			defaultObjectFieldSelector(v.DownwardAPI.Items[i].FieldRef)
+		}
+	case v.HostPath != nil:
+		if v.HostPath.Type == nil {
+			hostPathType := corev1.HostPathUnset
+			v.HostPath.Type = &hostPathType
+		}
+	case v.Ephemeral != nil:
+		if v.Ephemeral.VolumeClaimTemplate != nil {
+			defaultPersistentVolumeClaimSpec(&v.Ephemeral.VolumeClaimTemplate.Spec)
+		}
+	}
+}
+
+// defaultContainer sets the fields of a container that are defaulted by the API server.
+func defaultContainer(c *corev1.Container, hostNetwork bool) {
+	if c.ImagePullPolicy == "" {
+		if imageTag(c.Image) == "latest" {
+			c.ImagePullPolicy = corev1.PullAlways
+		} else {
+			c.ImagePullPolicy = corev1.PullIfNotPresent
+		}
+	}
+	if c.TerminationMessagePath == "" {
+		c.TerminationMessagePath = corev1.TerminationMessagePathDefault
+	}
+	if c.TerminationMessagePolicy == "" {
+		c.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+	}
+	for i := range c.Ports {
+		if c.Ports[i].Protocol == "" {
+			c.Ports[i].Protocol = corev1.ProtocolTCP
+		}
+		// Since Kubernetes 1.28 only pods get the host port defaulted, not pod templates.
+		// Setting it anyway costs a single update on those clusters, not setting it would
+		// cause an update on every reconcile on older ones.
+		if hostNetwork && c.Ports[i].HostPort == 0 {
+			c.Ports[i].HostPort = c.Ports[i].ContainerPort
+		}
+	}
+	for i := range c.Env {
+		if c.Env[i].ValueFrom != nil {
+			defaultObjectFieldSelector(c.Env[i].ValueFrom.FieldRef)
+		}
+	}
+	defaultProbe(c.LivenessProbe)
+	defaultProbe(c.ReadinessProbe)
+	defaultProbe(c.StartupProbe)
+	if c.Lifecycle != nil {
+		defaultLifecycleHandler(c.Lifecycle.PostStart)
+		defaultLifecycleHandler(c.Lifecycle.PreStop)
+	}
+}
+
+func defaultProbe(p *corev1.Probe) {
+	if p == nil {
+		return
+	}
+	if p.TimeoutSeconds == 0 {
+		p.TimeoutSeconds = 1
+	}
+	if p.PeriodSeconds == 0 {
+		p.PeriodSeconds = 10
+	}
+	if p.SuccessThreshold == 0 {
+		p.SuccessThreshold = 1
+	}
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = 3
+	}
+	defaultHTTPGetAction(p.HTTPGet)
+	if p.GRPC != nil && p.GRPC.Service == nil {
+		p.GRPC.Service = pointer.String("")
+	}
+}
+
+func defaultLifecycleHandler(h *corev1.LifecycleHandler) {
+	if h != nil {
+		defaultHTTPGetAction(h.HTTPGet)
+	}
+}
+
+func defaultHTTPGetAction(a *corev1.HTTPGetAction) {
+	if a == nil {
+		return
+	}
+	if a.Path == "" {
+		a.Path = "/"
+	}
+	if a.Scheme == "" {
+		a.Scheme = corev1.URISchemeHTTP
+	}
+}
+
+func defaultObjectFieldSelector(s *corev1.ObjectFieldSelector) {
+	if s != nil && s.APIVersion == "" {
+		s.APIVersion = "v1"
+	}
+}
+
+// defaultService sets the fields of a Service that are defaulted by the API server.
+func defaultService(s *corev1.Service) {
+	if s.Spec.Type == "" {
+		s.Spec.Type = corev1.ServiceTypeClusterIP
+	}
+	if s.Spec.SessionAffinity == "" {
+		s.Spec.SessionAffinity = corev1.ServiceAffinityNone
+	}
+	if s.Spec.SessionAffinity == corev1.ServiceAffinityClientIP {
+		if s.Spec.SessionAffinityConfig == nil {
+			s.Spec.SessionAffinityConfig = &corev1.SessionAffinityConfig{}
+		}
+		if s.Spec.SessionAffinityConfig.ClientIP == nil {
+			s.Spec.SessionAffinityConfig.ClientIP = &corev1.ClientIPConfig{}
+		}
+		if s.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds == nil {
+			s.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds = pointer.Int32(corev1.DefaultClientIPServiceAffinitySeconds)
+		}
+	}
+	for i := range s.Spec.Ports {
+		port := &s.Spec.Ports[i]
+		if port.Protocol == "" {
+			port.Protocol = corev1.ProtocolTCP
+		}
+		if port.TargetPort == intstr.FromInt(0) || port.TargetPort == intstr.FromString("") {
+			port.TargetPort = intstr.FromInt(int(port.Port))
+		}
+	}
+	if s.Spec.Type == corev1.ServiceTypeNodePort || s.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		if s.Spec.ExternalTrafficPolicy == "" {
+			s.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeCluster
+		}
+	}
+	if s.Spec.Type == corev1.ServiceTypeLoadBalancer && s.Spec.AllocateLoadBalancerNodePorts == nil {
+		s.Spec.AllocateLoadBalancerNodePorts = pointer.Bool(true)
+	}
+	if s.Spec.Type != corev1.ServiceTypeExternalName && s.Spec.InternalTrafficPolicy == nil {
+		internalTrafficPolicy := corev1.ServiceInternalTrafficPolicyCluster
+		s.Spec.InternalTrafficPolicy = &internalTrafficPolicy
+	}
+}
+
+// defaultPersistentVolumeClaimSpec sets the fields of a PersistentVolumeClaim spec that are defaulted by the API server.
+func defaultPersistentVolumeClaimSpec(spec *corev1.PersistentVolumeClaimSpec) {
+	if spec.VolumeMode == nil {
+		volumeMode := corev1.PersistentVolumeFilesystem
+		spec.VolumeMode = &volumeMode
+	}
+}
+
+// defaultNetworkPolicy sets the fields of a NetworkPolicy that are defaulted by the API server.
+func defaultNetworkPolicy(n *networkv1.NetworkPolicy) {
+	for i := range n.Spec.Ingress {
+		defaultNetworkPolicyPorts(n.Spec.Ingress[i].Ports)
+	}
+	for i := range n.Spec.Egress {
+		defaultNetworkPolicyPorts(n.Spec.Egress[i].Ports)
+	}
+	if len(n.Spec.PolicyTypes) == 0 {
+		n.Spec.PolicyTypes = []networkv1.PolicyType{networkv1.PolicyTypeIngress}
+		if len(n.Spec.Egress) != 0 {
+			n.Spec.PolicyTypes = append(n.Spec.PolicyTypes, networkv1.PolicyTypeEgress)
+		}
+	}
+}
+
+func defaultNetworkPolicyPorts(ports []networkv1.NetworkPolicyPort) {
+	for i := range ports {
+		if ports[i].Protocol == nil {
+			protocol := corev1.ProtocolTCP
+			ports[i].Protocol = &protocol
+		}
+	}
+}
+
+// defaultRoleBinding sets the fields of a RoleBinding that are defaulted by the API server.
+func defaultRoleBinding(r *rbacv1.RoleBinding) {
+	for i := range r.Subjects {
+		subject := &r.Subjects[i]
+		if subject.APIGroup == "" && (subject.Kind == rbacv1.UserKind || subject.Kind == rbacv1.GroupKind) {
+			subject.APIGroup = rbacv1.GroupName
+		}
+	}
+}
+
+// defaultNamespace sets the fields of a Namespace that are set by the API server.
+func defaultNamespace(n *corev1.Namespace) {
+	if n.Labels == nil {
+		n.Labels = map[string]string{}
+	}
+	n.Labels[corev1.LabelMetadataName] = n.Name
+}
+
+// defaultLimitRange sets the fields of a LimitRange that are defaulted by the API server.
+func defaultLimitRange(l *corev1.LimitRange) {
+	for i := range l.Spec.Limits {
+		item := &l.Spec.Limits[i]
+		if item.Type != corev1.LimitTypeContainer {
+			continue
+		}
+		if item.Default == nil {
+			item.Default = corev1.ResourceList{}
+		}
+		if item.DefaultRequest == nil {
+			item.DefaultRequest = corev1.ResourceList{}
+		}
+		// A missing default limit defaults to the max, and a missing default request to the
+		// default limit or else the min.
+		for name, value := range item.Max {
+			if _, ok := item.Default[name]; !ok {
+				item.Default[name] = value.DeepCopy()
+			}
+		}
+		for name, value := range item.Default {
+			if _, ok := item.DefaultRequest[name]; !ok {
+				item.DefaultRequest[name] = value.DeepCopy()
+			}
+		}
+		for name, value := range item.Min {
+			if _, ok := item.DefaultRequest[name]; !ok {
+				item.DefaultRequest[name] = value.DeepCopy()
+			}
+		}
+	}
+}
+
+// imageTag returns the tag of an image reference, "latest" if it has neither a tag nor
+// a digest and an empty string if it is only referenced by digest.
+func imageTag(image string) string {
+	name, digest := image, false
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], true
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[i+1:]
+	}
+	if digest {
+		return ""
+	}
+	return "latest"
+}
@@ -0,0 +1,1039 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The live objects in these tests are written out the way the API server returns the desired
+// objects after creating them, i.e. with its defaults and the fields it sets itself. They are
+// deliberately not built with the defaulting functions under test.
+
+// copyFunc adapts a kind specific Copy function to client.Object.
+func copyFunc[T client.Object](fn func(from, to T, log logr.Logger) bool) func(from, to client.Object) bool {
+	return func(from, to client.Object) bool {
+		return fn(from.(T), to.(T), logr.Discard())
+	}
+}
+
+// serverMeta returns meta with the fields the API server sets on every object.
+func serverMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	meta.UID = "4f7a2d6e-5b0c-4c1e-9a53-0d2b8e6f1c3a"
+	meta.ResourceVersion = "12345"
+	meta.Generation = 1
+	meta.CreationTimestamp = metav1.NewTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	return meta
+}
+
+func TestCopyIsIdempotentWithServerDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		desired   client.Object
+		live      client.Object
+		copy      func(from, to client.Object) bool
+		immutable immutableFn
+	}{
+		{
+			name:      "Deployment",
+			desired:   desiredDeployment(),
+			live:      liveDeployment(),
+			copy:      copyFunc(CopyDeploymentFields),
+			immutable: deploymentImmutableChanges,
+		},
+		{
+			name:      "Deployment with Recreate strategy and host network",
+			desired:   desiredHostNetworkDeployment(),
+			live:      liveHostNetworkDeployment(),
+			copy:      copyFunc(CopyDeploymentFields),
+			immutable: deploymentImmutableChanges,
+		},
+		{
+			name:      "Deployment with gRPC probes and an ephemeral volume",
+			desired:   desiredGRPCDeployment(),
+			live:      liveGRPCDeployment(),
+			copy:      copyFunc(CopyDeploymentFields),
+			immutable: deploymentImmutableChanges,
+		},
+		{
+			name:      "StatefulSet",
+			desired:   desiredStatefulSet(),
+			live:      liveStatefulSet(),
+			copy:      copyFunc(CopyStatefulSetFields),
+			immutable: statefulSetImmutableChanges,
+		},
+		{
+			name:      "ClusterIP Service",
+			desired:   desiredService(corev1.ServiceTypeClusterIP),
+			live:      liveService(corev1.ServiceTypeClusterIP),
+			copy:      copyFunc(CopyServiceFields),
+			immutable: serviceImmutableChanges,
+		},
+		{
+			name:      "NodePort Service",
+			desired:   desiredService(corev1.ServiceTypeNodePort),
+			live:      liveService(corev1.ServiceTypeNodePort),
+			copy:      copyFunc(CopyServiceFields),
+			immutable: serviceImmutableChanges,
+		},
+		{
+			name:      "LoadBalancer Service",
+			desired:   desiredService(corev1.ServiceTypeLoadBalancer),
+			live:      liveService(corev1.ServiceTypeLoadBalancer),
+			copy:      copyFunc(CopyServiceFields),
+			immutable: serviceImmutableChanges,
+		},
+		{
+			name:      "LoadBalancer Service with local traffic policy",
+			desired:   desiredLocalLoadBalancerService(),
+			live:      liveLocalLoadBalancerService(),
+			copy:      copyFunc(CopyServiceFields),
+			immutable: serviceImmutableChanges,
+		},
+		{
+			name:      "ExternalName Service",
+			desired:   desiredExternalNameService(),
+			live:      liveExternalNameService(),
+			copy:      copyFunc(CopyServiceFields),
+			immutable: serviceImmutableChanges,
+		},
+		{
+			name:      "Secret",
+			desired:   desiredSecret(),
+			live:      liveSecret(),
+			copy:      copyFunc(CopySecretFields),
+			immutable: secretImmutableChanges,
+		},
+		{
+			name:      "Secret without type",
+			desired:   desiredUntypedTLSSecret(),
+			live:      liveTLSSecret(),
+			copy:      copyFunc(CopySecretFields),
+			immutable: secretImmutableChanges,
+		},
+		{
+			name:    "ConfigMap",
+			desired: desiredConfigMap(),
+			live:    liveConfigMap(),
+			copy:    copyFunc(CopyConfigMap),
+		},
+		{
+			name:    "ServiceAccount",
+			desired: desiredServiceAccount(),
+			live:    liveServiceAccount(),
+			copy:    copyFunc(CopyServiceAccount),
+		},
+		{
+			name:    "PersistentVolumeClaim",
+			desired: desiredPersistentVolumeClaim(),
+			live:    livePersistentVolumeClaim(),
+			copy:    copyFunc(CopyPersistentVolumeClaim),
+		},
+		{
+			name:    "NetworkPolicy",
+			desired: desiredNetworkPolicy(),
+			live:    liveNetworkPolicy(),
+			copy:    copyFunc(CopyNetworkPolicy),
+		},
+		{
+			name:    "default deny NetworkPolicy",
+			desired: DefaultDenyNetworkPolicy("team-a", networkv1.PolicyTypeIngress, networkv1.PolicyTypeEgress),
+			live:    liveDefaultDenyNetworkPolicy(),
+			copy:    copyFunc(CopyNetworkPolicy),
+		},
+		{
+			name:      "RoleBinding",
+			desired:   desiredRoleBinding(),
+			live:      liveRoleBinding(),
+			copy:      copyFunc(CopyRoleBinding),
+			immutable: roleBindingImmutableChanges,
+		},
+		{
+			name:    "LimitRange",
+			desired: desiredLimitRange(),
+			live:    liveLimitRange(),
+			copy:    copyFunc(CopyLimitRange),
+		},
+		{
+			name:    "ResourceQuota",
+			desired: desiredResourceQuota(),
+			live:    liveResourceQuota(),
+			copy:    copyFunc(CopyResourceQuota),
+		},
+		{
+			name:    "Namespace",
+			desired: desiredNamespace(),
+			live:    liveNamespace(),
+			copy:    copyFunc(CopyNamespace),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := tt.desired.DeepCopyObject().(client.Object)
+			to := tt.live.DeepCopyObject().(client.Object)
+			if tt.copy(desired, to) {
+				t.Errorf("Copy reported a difference to the live object")
+			}
+			if changes := Diff("", tt.live, to); len(changes) != 0 {
+				t.Errorf("Copy changed the live object: %v", changes.Strings())
+			}
+			if changes := Diff("", tt.desired, desired); len(changes) != 0 {
+				t.Errorf("Copy changed the desired object: %v", changes.Strings())
+			}
+			if tt.immutable != nil {
+				if changes := tt.immutable(tt.desired, tt.live); len(changes) != 0 {
+					t.Errorf("immutable fields reported as changed: %v", changes.Strings())
+				}
+			}
+		})
+	}
+}
+
+func desiredDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": "web"}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "web",
+					InitContainers: []corev1.Container{{
+						Name:  "migrate",
+						Image: "registry.example.com/web/migrate@sha256:4bcb2ee6f2c1f7d5e0c8e3e1b2f9f6a0d7c3b5a4e2d1c0b9a8f7e6d5c4b3a291",
+					}},
+					Containers: []corev1.Container{
+						{
+							Name:  "web",
+							Image: "nginx:1.25",
+							Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+							Env: []corev1.EnvVar{{
+								Name:      "POD_NAME",
+								ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+							}},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Port: intstr.FromString("http")}},
+							},
+							LivenessProbe: &corev1.Probe{
+								ProbeHandler:  corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(8080)}},
+								PeriodSeconds: 20,
+							},
+							Lifecycle: &corev1.Lifecycle{
+								PreStop: &corev1.LifecycleHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/drain", Port: intstr.FromString("http")}},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "config", MountPath: "/etc/web"},
+								{Name: "cache", MountPath: "/cache"},
+								{Name: "token", MountPath: "/var/run/secrets/tokens"},
+								{Name: "tls", MountPath: "/etc/tls"},
+								{Name: "podinfo", MountPath: "/etc/podinfo"},
+								{Name: "logs", MountPath: "/var/log/web"},
+							},
+						},
+						{
+							Name:    "tail",
+							Image:   "busybox",
+							Command: []string{"tail", "-F", "/var/log/web/access.log"},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "web"},
+						}}},
+						{Name: "cache"},
+						{Name: "token", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{
+								{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token", Audience: "vault"}},
+								{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{{
+									Path: "namespace", FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+								}}}},
+							},
+						}}},
+						{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "web-tls"}}},
+						{Name: "podinfo", VolumeSource: corev1.VolumeSource{DownwardAPI: &corev1.DownwardAPIVolumeSource{
+							Items: []corev1.DownwardAPIVolumeFile{{Path: "labels", FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels"}}},
+						}}},
+						{Name: "logs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log/web"}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func liveDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": "web"}
+	maxUnavailable, maxSurge := intstr.FromString("25%"), intstr.FromString("25%")
+	hostPathUnset := corev1.HostPathUnset
+	return &appsv1.Deployment{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Labels:      labels,
+			Annotations: map[string]string{"deployment.kubernetes.io/revision": "1"},
+		}),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Strategy: appsv1.DeploymentStrategy{
+				Type:          appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &maxUnavailable, MaxSurge: &maxSurge},
+			},
+			RevisionHistoryLimit:    pointer.Int32(10),
+			ProgressDeadlineSeconds: pointer.Int32(600),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName:            "web",
+					RestartPolicy:                 corev1.RestartPolicyAlways,
+					DNSPolicy:                     corev1.DNSClusterFirst,
+					SecurityContext:               &corev1.PodSecurityContext{},
+					TerminationGracePeriodSeconds: pointer.Int64(30),
+					SchedulerName:                 "default-scheduler",
+					InitContainers: []corev1.Container{{
+						Name:                     "migrate",
+						Image:                    "registry.example.com/web/migrate@sha256:4bcb2ee6f2c1f7d5e0c8e3e1b2f9f6a0d7c3b5a4e2d1c0b9a8f7e6d5c4b3a291",
+						ImagePullPolicy:          corev1.PullIfNotPresent,
+						TerminationMessagePath:   "/dev/termination-log",
+						TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+					}},
+					Containers: []corev1.Container{
+						{
+							Name:            "web",
+							Image:           "nginx:1.25",
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Ports:           []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+							Env: []corev1.EnvVar{{
+								Name:      "POD_NAME",
+								ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.name"}},
+							}},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+									Path: "/", Port: intstr.FromString("http"), Scheme: corev1.URISchemeHTTP,
+								}},
+								TimeoutSeconds:   1,
+								PeriodSeconds:    10,
+								SuccessThreshold: 1,
+								FailureThreshold: 3,
+							},
+							LivenessProbe: &corev1.Probe{
+								ProbeHandler:     corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(8080)}},
+								TimeoutSeconds:   1,
+								PeriodSeconds:    20,
+								SuccessThreshold: 1,
+								FailureThreshold: 3,
+							},
+							Lifecycle: &corev1.Lifecycle{
+								PreStop: &corev1.LifecycleHandler{HTTPGet: &corev1.HTTPGetAction{
+									Path: "/drain", Port: intstr.FromString("http"), Scheme: corev1.URISchemeHTTP,
+								}},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "config", MountPath: "/etc/web"},
+								{Name: "cache", MountPath: "/cache"},
+								{Name: "token", MountPath: "/var/run/secrets/tokens"},
+								{Name: "tls", MountPath: "/etc/tls"},
+								{Name: "podinfo", MountPath: "/etc/podinfo"},
+								{Name: "logs", MountPath: "/var/log/web"},
+							},
+							TerminationMessagePath:   "/dev/termination-log",
+							TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+						},
+						{
+							Name:                     "tail",
+							Image:                    "busybox",
+							Command:                  []string{"tail", "-F", "/var/log/web/access.log"},
+							ImagePullPolicy:          corev1.PullAlways,
+							TerminationMessagePath:   "/dev/termination-log",
+							TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+						},
+					},
+					Volumes: []corev1.Volume{
+						{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "web"},
+							DefaultMode:          pointer.Int32(0644),
+						}}},
+						{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+						{Name: "token", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{
+								{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token", Audience: "vault", ExpirationSeconds: pointer.Int64(3600)}},
+								{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{{
+									Path: "namespace", FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.namespace"},
+								}}}},
+							},
+							DefaultMode: pointer.Int32(0644),
+						}}},
+						{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+							SecretName:  "web-tls",
+							DefaultMode: pointer.Int32(0644),
+						}}},
+						{Name: "podinfo", VolumeSource: corev1.VolumeSource{DownwardAPI: &corev1.DownwardAPIVolumeSource{
+							Items:       []corev1.DownwardAPIVolumeFile{{Path: "labels", FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.labels"}}},
+							DefaultMode: pointer.Int32(0644),
+						}}},
+						{Name: "logs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log/web", Type: &hostPathUnset}}},
+					},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      1,
+			AvailableReplicas:  1,
+		},
+	}
+}
+
+func desiredHostNetworkDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": "node-exporter"}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-exporter", Namespace: "monitoring"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(3),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					HostNetwork: true,
+					DNSPolicy:   corev1.DNSClusterFirstWithHostNet,
+					Containers: []corev1.Container{{
+						Name:            "node-exporter",
+						Image:           "prom/node-exporter:v1.7.0",
+						ImagePullPolicy: corev1.PullAlways,
+						Ports:           []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9100, Protocol: corev1.ProtocolTCP}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func liveHostNetworkDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": "node-exporter"}
+	return &appsv1.Deployment{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{
+			Name:        "node-exporter",
+			Namespace:   "monitoring",
+			Annotations: map[string]string{"deployment.kubernetes.io/revision": "3"},
+		}),
+		Spec: appsv1.DeploymentSpec{
+			Replicas:                pointer.Int32(3),
+			Selector:                &metav1.LabelSelector{MatchLabels: labels},
+			Strategy:                appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			RevisionHistoryLimit:    pointer.Int32(10),
+			ProgressDeadlineSeconds: pointer.Int32(600),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					HostNetwork:                   true,
+					DNSPolicy:                     corev1.DNSClusterFirstWithHostNet,
+					RestartPolicy:                 corev1.RestartPolicyAlways,
+					SecurityContext:               &corev1.PodSecurityContext{},
+					TerminationGracePeriodSeconds: pointer.Int64(30),
+					SchedulerName:                 "default-scheduler",
+					Containers: []corev1.Container{{
+						Name:                     "node-exporter",
+						Image:                    "prom/node-exporter:v1.7.0",
+						ImagePullPolicy:          corev1.PullAlways,
+						Ports:                    []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9100, HostPort: 9100, Protocol: corev1.ProtocolTCP}},
+						TerminationMessagePath:   "/dev/termination-log",
+						TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+					}},
+				},
+			},
+		},
+	}
+}
+
+func desiredGRPCDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": "api"}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "api",
+						Image: "registry.example.com/api:v2.3.1",
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{GRPC: &corev1.GRPCAction{Port: 9090}},
+						},
+						LivenessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{GRPC: &corev1.GRPCAction{Port: 9090, Service: pointer.String("liveness")}},
+						},
+						VolumeMounts: []corev1.VolumeMount{{Name: "scratch", MountPath: "/scratch"}},
+					}},
+					Volumes: []corev1.Volume{{Name: "scratch", VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{
+						VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+							Spec: corev1.PersistentVolumeClaimSpec{
+								AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+								Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+									corev1.ResourceStorage: resource.MustParse("1Gi"),
+								}},
+							},
+						},
+					}}}},
+				},
+			},
+		},
+	}
+}
+
+func liveGRPCDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": "api"}
+	maxUnavailable, maxSurge := intstr.FromString("25%"), intstr.FromString("25%")
+	filesystem := corev1.PersistentVolumeFilesystem
+	return &appsv1.Deployment{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "default",
+			Annotations: map[string]string{"deployment.kubernetes.io/revision": "1"},
+		}),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Strategy: appsv1.DeploymentStrategy{
+				Type:          appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &maxUnavailable, MaxSurge: &maxSurge},
+			},
+			RevisionHistoryLimit:    pointer.Int32(10),
+			ProgressDeadlineSeconds: pointer.Int32(600),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                 corev1.RestartPolicyAlways,
+					DNSPolicy:                     corev1.DNSClusterFirst,
+					SecurityContext:               &corev1.PodSecurityContext{},
+					TerminationGracePeriodSeconds: pointer.Int64(30),
+					SchedulerName:                 "default-scheduler",
+					Containers: []corev1.Container{{
+						Name:            "api",
+						Image:           "registry.example.com/api:v2.3.1",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler:     corev1.ProbeHandler{GRPC: &corev1.GRPCAction{Port: 9090, Service: pointer.String("")}},
+							TimeoutSeconds:   1,
+							PeriodSeconds:    10,
+							SuccessThreshold: 1,
+							FailureThreshold: 3,
+						},
+						LivenessProbe: &corev1.Probe{
+							ProbeHandler:     corev1.ProbeHandler{GRPC: &corev1.GRPCAction{Port: 9090, Service: pointer.String("liveness")}},
+							TimeoutSeconds:   1,
+							PeriodSeconds:    10,
+							SuccessThreshold: 1,
+							FailureThreshold: 3,
+						},
+						VolumeMounts:             []corev1.VolumeMount{{Name: "scratch", MountPath: "/scratch"}},
+						TerminationMessagePath:   "/dev/termination-log",
+						TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+					}},
+					Volumes: []corev1.Volume{{Name: "scratch", VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{
+						VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+							Spec: corev1.PersistentVolumeClaimSpec{
+								AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+								Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+									corev1.ResourceStorage: resource.MustParse("1Gi"),
+								}},
+								VolumeMode: &filesystem,
+							},
+						},
+					}}}},
+				},
+			},
+		},
+	}
+}
+
+func desiredStatefulSet() *appsv1.StatefulSet {
+	labels := map[string]string{"app": "db"}
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Labels: labels},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: "db",
+			Selector:    &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:         "postgres",
+						Image:        "postgres:16",
+						Ports:        []corev1.ContainerPort{{Name: "postgres", ContainerPort: 5432}},
+						VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/var/lib/postgresql/data"}},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: "data"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("10Gi"),
+					}},
+				},
+			}},
+		},
+	}
+}
+
+func liveStatefulSet() *appsv1.StatefulSet {
+	labels := map[string]string{"app": "db"}
+	filesystem := corev1.PersistentVolumeFilesystem
+	return &appsv1.StatefulSet{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "db", Namespace: "default", Labels: labels}),
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            pointer.Int32(1),
+			ServiceName:         "db",
+			Selector:            &metav1.LabelSelector{MatchLabels: labels},
+			PodManagementPolicy: appsv1.OrderedReadyPodManagement,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: pointer.Int32(0)},
+			},
+			RevisionHistoryLimit: pointer.Int32(10),
+			PersistentVolumeClaimRetentionPolicy: &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+				WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                 corev1.RestartPolicyAlways,
+					DNSPolicy:                     corev1.DNSClusterFirst,
+					SecurityContext:               &corev1.PodSecurityContext{},
+					TerminationGracePeriodSeconds: pointer.Int64(30),
+					SchedulerName:                 "default-scheduler",
+					Containers: []corev1.Container{{
+						Name:                     "postgres",
+						Image:                    "postgres:16",
+						ImagePullPolicy:          corev1.PullIfNotPresent,
+						Ports:                    []corev1.ContainerPort{{Name: "postgres", ContainerPort: 5432, Protocol: corev1.ProtocolTCP}},
+						VolumeMounts:             []corev1.VolumeMount{{Name: "data", MountPath: "/var/lib/postgresql/data"}},
+						TerminationMessagePath:   "/dev/termination-log",
+						TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+				ObjectMeta: metav1.ObjectMeta{Name: "data"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("10Gi"),
+					}},
+					VolumeMode: &filesystem,
+				},
+				Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+			}},
+		},
+		Status: appsv1.StatefulSetStatus{
+			ObservedGeneration: 1,
+			Replicas:           1,
+			ReadyReplicas:      1,
+			CurrentRevision:    "db-5d9c7b8f6",
+			UpdateRevision:     "db-5d9c7b8f6",
+		},
+	}
+}
+
+func desiredService(serviceType corev1.ServiceType) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: corev1.ServiceSpec{
+			Type:            serviceType,
+			Selector:        map[string]string{"app": "web"},
+			SessionAffinity: corev1.ServiceAffinityClientIP,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+				{Name: "metrics", Port: 9090},
+			},
+		},
+	}
+}
+
+func liveService(serviceType corev1.ServiceType) *corev1.Service {
+	internalTrafficPolicy := corev1.ServiceInternalTrafficPolicyCluster
+	singleStack := corev1.IPFamilyPolicySingleStack
+	service := &corev1.Service{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}}),
+		Spec: corev1.ServiceSpec{
+			Type:            serviceType,
+			Selector:        map[string]string{"app": "web"},
+			ClusterIP:       "10.96.142.17",
+			ClusterIPs:      []string{"10.96.142.17"},
+			IPFamilies:      []corev1.IPFamily{corev1.IPv4Protocol},
+			IPFamilyPolicy:  &singleStack,
+			SessionAffinity: corev1.ServiceAffinityClientIP,
+			SessionAffinityConfig: &corev1.SessionAffinityConfig{
+				ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: pointer.Int32(10800)},
+			},
+			InternalTrafficPolicy: &internalTrafficPolicy,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http"), Protocol: corev1.ProtocolTCP},
+				{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt(9090), Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+	if serviceType == corev1.ServiceTypeNodePort || serviceType == corev1.ServiceTypeLoadBalancer {
+		service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeCluster
+		service.Spec.Ports[0].NodePort = 31080
+		service.Spec.Ports[1].NodePort = 31090
+	}
+	if serviceType == corev1.ServiceTypeLoadBalancer {
+		service.Spec.AllocateLoadBalancerNodePorts = pointer.Bool(true)
+		service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}
+	}
+	return service
+}
+
+func desiredLocalLoadBalancerService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ingress",
+			Namespace:   "ingress",
+			Annotations: map[string]string{"service.beta.kubernetes.io/aws-load-balancer-type": "nlb"},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                          corev1.ServiceTypeLoadBalancer,
+			Selector:                      map[string]string{"app": "ingress"},
+			ExternalTrafficPolicy:         corev1.ServiceExternalTrafficPolicyTypeLocal,
+			AllocateLoadBalancerNodePorts: pointer.Bool(true),
+			Ports:                         []corev1.ServicePort{{Name: "https", Port: 443, TargetPort: intstr.FromInt(8443)}},
+		},
+	}
+}
+
+func liveLocalLoadBalancerService() *corev1.Service {
+	internalTrafficPolicy := corev1.ServiceInternalTrafficPolicyCluster
+	singleStack := corev1.IPFamilyPolicySingleStack
+	return &corev1.Service{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{
+			Name:        "ingress",
+			Namespace:   "ingress",
+			Annotations: map[string]string{"service.beta.kubernetes.io/aws-load-balancer-type": "nlb"},
+			Finalizers:  []string{"service.kubernetes.io/load-balancer-cleanup"},
+		}),
+		Spec: corev1.ServiceSpec{
+			Type:                          corev1.ServiceTypeLoadBalancer,
+			Selector:                      map[string]string{"app": "ingress"},
+			ClusterIP:                     "10.96.8.1",
+			ClusterIPs:                    []string{"10.96.8.1"},
+			IPFamilies:                    []corev1.IPFamily{corev1.IPv4Protocol},
+			IPFamilyPolicy:                &singleStack,
+			SessionAffinity:               corev1.ServiceAffinityNone,
+			ExternalTrafficPolicy:         corev1.ServiceExternalTrafficPolicyTypeLocal,
+			HealthCheckNodePort:           32456,
+			InternalTrafficPolicy:         &internalTrafficPolicy,
+			AllocateLoadBalancerNodePorts: pointer.Bool(true),
+			Ports:                         []corev1.ServicePort{{Name: "https", Port: 443, TargetPort: intstr.FromInt(8443), NodePort: 30443, Protocol: corev1.ProtocolTCP}},
+		},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+			Ingress: []corev1.LoadBalancerIngress{{Hostname: "ingress-0123456789.elb.us-east-1.amazonaws.com"}},
+		}},
+	}
+}
+
+func desiredExternalNameService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "database", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:         corev1.ServiceTypeExternalName,
+			ExternalName: "db.example.com",
+		},
+	}
+}
+
+func liveExternalNameService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "database", Namespace: "default"}),
+		Spec: corev1.ServiceSpec{
+			Type:            corev1.ServiceTypeExternalName,
+			ExternalName:    "db.example.com",
+			SessionAffinity: corev1.ServiceAffinityNone,
+		},
+	}
+}
+
+func desiredSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		StringData: map[string]string{"username": "admin"},
+	}
+}
+
+func liveSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "db", Namespace: "default"}),
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"password": []byte("s3cr3t"), "username": []byte("admin")},
+	}
+}
+
+func desiredUntypedTLSSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-tls", Namespace: "default"},
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+	}
+}
+
+func liveTLSSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "web-tls", Namespace: "default"}),
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+	}
+}
+
+func desiredConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Data:       map[string]string{"nginx.conf": "worker_processes 1;\n"},
+		BinaryData: map[string][]byte{"favicon.ico": {0x00, 0x00, 0x01, 0x00}},
+	}
+}
+
+func liveConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}}),
+		Data:       map[string]string{"nginx.conf": "worker_processes 1;\n"},
+		BinaryData: map[string][]byte{"favicon.ico": {0x00, 0x00, 0x01, 0x00}},
+	}
+}
+
+func desiredServiceAccount() *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta:                   metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		ImagePullSecrets:             []corev1.LocalObjectReference{{Name: "registry"}},
+		AutomountServiceAccountToken: pointer.Bool(false),
+	}
+}
+
+func liveServiceAccount() *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta:                   serverMeta(metav1.ObjectMeta{Name: "web", Namespace: "default"}),
+		ImagePullSecrets:             []corev1.LocalObjectReference{{Name: "registry"}},
+		AutomountServiceAccountToken: pointer.Bool(false),
+		// Added by the token controller of clusters before Kubernetes 1.24.
+		Secrets: []corev1.ObjectReference{{Name: "web-token-x7k2p"}},
+	}
+}
+
+func desiredPersistentVolumeClaim() *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse("5Gi"),
+			}},
+		},
+	}
+}
+
+func livePersistentVolumeClaim() *corev1.PersistentVolumeClaim {
+	filesystem := corev1.PersistentVolumeFilesystem
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{
+			Name:      "data",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"pv.kubernetes.io/bind-completed":               "yes",
+				"pv.kubernetes.io/bound-by-controller":          "yes",
+				"volume.beta.kubernetes.io/storage-provisioner": "ebs.csi.aws.com",
+				"volume.kubernetes.io/storage-provisioner":      "ebs.csi.aws.com",
+			},
+			Finalizers: []string{"kubernetes.io/pvc-protection"},
+		}),
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse("5Gi"),
+			}},
+			StorageClassName: pointer.String("gp3"),
+			VolumeMode:       &filesystem,
+			VolumeName:       "pvc-0b6f4c52-8f0e-4d7b-9a3e-2c1d5e7f9a11",
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:       corev1.ClaimBound,
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Capacity:    corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+		},
+	}
+}
+
+func desiredNetworkPolicy() *networkv1.NetworkPolicy {
+	return &networkv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: networkv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Ingress: []networkv1.NetworkPolicyIngressRule{{
+				From:  []networkv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ingress"}}}},
+				Ports: []networkv1.NetworkPolicyPort{{Port: &intstr.IntOrString{Type: intstr.String, StrVal: "http"}}},
+			}},
+			Egress: []networkv1.NetworkPolicyEgressRule{{
+				To:    []networkv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}}},
+				Ports: []networkv1.NetworkPolicyPort{{Port: &intstr.IntOrString{IntVal: 5432}}},
+			}},
+		},
+	}
+}
+
+func liveNetworkPolicy() *networkv1.NetworkPolicy {
+	tcp := corev1.ProtocolTCP
+	return &networkv1.NetworkPolicy{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "web", Namespace: "default"}),
+		Spec: networkv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Ingress: []networkv1.NetworkPolicyIngressRule{{
+				From:  []networkv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ingress"}}}},
+				Ports: []networkv1.NetworkPolicyPort{{Protocol: &tcp, Port: &intstr.IntOrString{Type: intstr.String, StrVal: "http"}}},
+			}},
+			Egress: []networkv1.NetworkPolicyEgressRule{{
+				To:    []networkv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}}},
+				Ports: []networkv1.NetworkPolicyPort{{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 5432}}},
+			}},
+			PolicyTypes: []networkv1.PolicyType{networkv1.PolicyTypeIngress, networkv1.PolicyTypeEgress},
+		},
+	}
+}
+
+func liveDefaultDenyNetworkPolicy() *networkv1.NetworkPolicy {
+	return &networkv1.NetworkPolicy{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "default-deny-ingress-egress", Namespace: "team-a"}),
+		Spec: networkv1.NetworkPolicySpec{
+			PolicyTypes: []networkv1.PolicyType{networkv1.PolicyTypeIngress, networkv1.PolicyTypeEgress},
+		},
+	}
+}
+
+func desiredRoleBinding() *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "edit", Namespace: "team-a"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "edit"},
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.UserKind, Name: "alice@example.com"},
+			{Kind: rbacv1.GroupKind, Name: "team-a"},
+			{Kind: rbacv1.ServiceAccountKind, Name: "deployer", Namespace: "ci"},
+		},
+	}
+}
+
+func liveRoleBinding() *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "edit", Namespace: "team-a"}),
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "edit"},
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "alice@example.com"},
+			{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "team-a"},
+			{Kind: rbacv1.ServiceAccountKind, Name: "deployer", Namespace: "ci"},
+		},
+	}
+}
+
+func desiredLimitRange() *corev1.LimitRange {
+	return &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "team-a"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{
+			{
+				Type:    corev1.LimitTypeContainer,
+				Max:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+				Min:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			},
+			{
+				Type: corev1.LimitTypeContainer,
+				Min:  corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("64Mi")},
+			},
+			{
+				Type: corev1.LimitTypePod,
+				Max:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			},
+		}},
+	}
+}
+
+func liveLimitRange() *corev1.LimitRange {
+	return &corev1.LimitRange{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "limits", Namespace: "team-a"}),
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{
+			{
+				Type:           corev1.LimitTypeContainer,
+				Max:            corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+				Min:            corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				Default:        corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+				DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+			},
+			{
+				Type:           corev1.LimitTypeContainer,
+				Min:            corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("64Mi")},
+				DefaultRequest: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("64Mi")},
+			},
+			{
+				Type: corev1.LimitTypePod,
+				Max:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			},
+		}},
+	}
+}
+
+func desiredResourceQuota() *corev1.ResourceQuota {
+	return &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "team-a"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+			corev1.ResourcePods:        resource.MustParse("20"),
+			corev1.ResourceRequestsCPU: resource.MustParse("4"),
+		}},
+	}
+}
+
+func liveResourceQuota() *corev1.ResourceQuota {
+	hard := corev1.ResourceList{
+		corev1.ResourcePods:        resource.MustParse("20"),
+		corev1.ResourceRequestsCPU: resource.MustParse("4"),
+	}
+	return &corev1.ResourceQuota{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{Name: "quota", Namespace: "team-a"}),
+		Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: hard,
+			Used: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("3"), corev1.ResourceRequestsCPU: resource.MustParse("750m")},
+		},
+	}
+}
+
+func desiredNamespace() *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}},
+	}
+}
+
+func liveNamespace() *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: serverMeta(metav1.ObjectMeta{
+			Name:   "team-a",
+			Labels: map[string]string{"team": "a", "kubernetes.io/metadata.name": "team-a"},
+		}),
+		Spec:   corev1.NamespaceSpec{Finalizers: []corev1.FinalizerName{corev1.FinalizerKubernetes}},
+		Status: corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	}
+}
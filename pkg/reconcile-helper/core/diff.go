@@ -0,0 +1,380 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// redactedValue replaces values that must not end up in logs or results.
+const redactedValue = "<redacted>"
+
+// leafTypes are compared as a whole using semantic equality instead of being walked field by field.
+var leafTypes = map[reflect.Type]bool{
+	reflect.TypeOf(resource.Quantity{}):  true,
+	reflect.TypeOf(metav1.Time{}):        true,
+	reflect.TypeOf(metav1.MicroTime{}):   true,
+	reflect.TypeOf(intstr.IntOrString{}): true,
+}
+
+// redactedPaths lists, per kind, the field paths whose values are redacted in changes.
+var redactedPaths = map[string][]string{
+	"Secret": {"data", "stringData"},
+}
+
+// Change is a single field level difference between an existing and a wanted value.
+type Change struct {
+	// Path is the JSON path of the field, list entries that have a name are
+	// addressed by it, e.g. "spec.template.spec.containers[name=app].image".
+	Path string
+
+	// From is the existing value, nil if the field is being added.
+	From interface{}
+
+	// To is the wanted value, nil if the field is being removed.
+	To interface{}
+}
+
+// String returns the change in the form "path: from -> to".
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, formatValue(c.From), formatValue(c.To))
+}
+
+// Changes is a list of field level differences.
+type Changes []Change
+
+// Paths returns the paths of all changes.
+func (c Changes) Paths() []string {
+	paths := make([]string, 0, len(c))
+	for _, change := range c {
+		paths = append(paths, change.Path)
+	}
+	return paths
+}
+
+// Strings returns the human-readable form of all changes.
+func (c Changes) Strings() []string {
+	strs := make([]string, 0, len(c))
+	for _, change := range c {
+		strs = append(strs, change.String())
+	}
+	return strs
+}
+
+// Redact returns a copy of the changes in which the values of the given paths,
+// and of all fields nested below them, are replaced.
+func (c Changes) Redact(paths ...string) Changes {
+	if len(paths) == 0 {
+		return c
+	}
+	redacted := make(Changes, 0, len(c))
+	for _, change := range c {
+		if hasPathPrefix(change.Path, paths) {
+			if change.From != nil {
+				change.From = redactedValue
+			}
+			if change.To != nil {
+				change.To = redactedValue
+			}
+		}
+		redacted = append(redacted, change)
+	}
+	return redacted
+}
+
+// Without returns the changes whose paths are not, and are not nested below, any of the given paths.
+func (c Changes) Without(paths ...string) Changes {
+	var filtered Changes
+	for _, change := range c {
+		if !hasPathPrefix(change.Path, paths) {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// Diff returns the field level differences between from and to. Nil and empty
+// values are considered equal, resource quantities are compared semantically and
+// lists whose entries all have a unique name are matched by name rather than index.
+// path is prepended to the reported paths, it is empty when diffing whole objects.
+func Diff(path string, from, to interface{}) Changes {
+	var changes Changes
+	walkDiff(path, reflect.ValueOf(from), reflect.ValueOf(to), &changes)
+	return changes
+}
+
+// copyField copies wanted into existing. If they differ the differences are logged
+// and true is returned. The values of redacted fields of kind are never logged.
+func copyField[V any](log logr.Logger, kind, path string, existing *V, wanted V) bool {
+	changes := Diff(path, *existing, wanted)
+	*existing = wanted
+	return logChanges(log, kind, path, changes)
+}
+
+// logChanges logs the changes made to the field at path of kind and returns true if there were any.
+func logChanges(log logr.Logger, kind, path string, changes Changes) bool {
+	if len(changes) == 0 {
+		return false
+	}
+	log.V(1).Info(fmt.Sprintf("reconciling %s due to %s change", kind, path))
+	log.V(2).Info(fmt.Sprintf("difference in %s %s", kind, path), "changes", changes.Redact(redactedPaths[kind]...).Strings())
+	return true
+}
+
+func walkDiff(path string, a, b reflect.Value, changes *Changes) {
+	if !a.IsValid() || !b.IsValid() {
+		if a.IsValid() != b.IsValid() {
+			*changes = append(*changes, Change{Path: path, From: valueOf(a), To: valueOf(b)})
+		}
+		return
+	}
+	// Values of different types, e.g. the dynamic types of two interface{} values, can't be
+	// walked together.
+	if a.Type() != b.Type() {
+		*changes = append(*changes, Change{Path: path, From: valueOf(a), To: valueOf(b)})
+		return
+	}
+
+	if leafTypes[a.Type()] {
+		if !equality.Semantic.DeepEqual(a.Interface(), b.Interface()) {
+			*changes = append(*changes, Change{Path: path, From: a.Interface(), To: b.Interface()})
+		}
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*changes = append(*changes, Change{Path: path, From: valueOf(a), To: valueOf(b)})
+			}
+			return
+		}
+		walkDiff(path, a.Elem(), b.Elem(), changes)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, inline := jsonName(field)
+			if name == "-" {
+				continue
+			}
+			fieldPath := path
+			if !inline {
+				fieldPath = joinPath(path, name)
+			}
+			walkDiff(fieldPath, a.Field(i), b.Field(i), changes)
+		}
+	case reflect.Slice, reflect.Array:
+		if a.Len() == 0 && b.Len() == 0 {
+			return
+		}
+		if a.Type().Elem().Kind() == reflect.Uint8 {
+			if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+				*changes = append(*changes, Change{Path: path, From: valueOf(a), To: valueOf(b)})
+			}
+			return
+		}
+		aKeys, aNamed := listKeys(a)
+		bKeys, bNamed := listKeys(b)
+		if aNamed && bNamed {
+			walkNamedList(path, a, b, aKeys, bKeys, changes)
+			return
+		}
+		if a.Len() != b.Len() {
+			*changes = append(*changes, Change{Path: path, From: valueOf(a), To: valueOf(b)})
+			return
+		}
+		for i := 0; i < a.Len(); i++ {
+			walkDiff(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i), changes)
+		}
+	case reflect.Map:
+		for _, k := range mapKeys(a, b) {
+			keyPath := fmt.Sprintf("%s[%v]", path, k)
+			av, bv := a.MapIndex(k), b.MapIndex(k)
+			if !av.IsValid() || !bv.IsValid() {
+				*changes = append(*changes, Change{Path: keyPath, From: valueOf(av), To: valueOf(bv)})
+				continue
+			}
+			walkDiff(keyPath, av, bv, changes)
+		}
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changes = append(*changes, Change{Path: path, From: a.Interface(), To: b.Interface()})
+		}
+	}
+}
+
+// walkNamedList diffs two lists whose entries are identified by their names.
+func walkNamedList(path string, a, b reflect.Value, aKeys, bKeys []string, changes *Changes) {
+	aIndex := make(map[string]int, len(aKeys))
+	for i, k := range aKeys {
+		aIndex[k] = i
+	}
+	bIndex := make(map[string]int, len(bKeys))
+	for i, k := range bKeys {
+		bIndex[k] = i
+	}
+
+	var common []string
+	for _, k := range aKeys {
+		if _, ok := bIndex[k]; ok {
+			common = append(common, k)
+		} else {
+			*changes = append(*changes, Change{Path: fmt.Sprintf("%s[name=%s]", path, k), From: a.Index(aIndex[k]).Interface()})
+		}
+	}
+	for _, k := range bKeys {
+		if _, ok := aIndex[k]; !ok {
+			*changes = append(*changes, Change{Path: fmt.Sprintf("%s[name=%s]", path, k), To: b.Index(bIndex[k]).Interface()})
+		}
+	}
+	for _, k := range common {
+		walkDiff(fmt.Sprintf("%s[name=%s]", path, k), a.Index(aIndex[k]), b.Index(bIndex[k]), changes)
+	}
+
+	// The order of named entries can still matter, e.g. for environment variables referencing each other.
+	if len(common) == len(aKeys) && len(common) == len(bKeys) && !reflect.DeepEqual(aKeys, bKeys) {
+		*changes = append(*changes, Change{Path: path, From: aKeys, To: bKeys})
+	}
+}
+
+// listKeys returns the names of the entries of list if every entry is a struct
+// with a unique, non-empty name field.
+func listKeys(list reflect.Value) ([]string, bool) {
+	elem := list.Type().Elem()
+	if elem.Kind() != reflect.Struct {
+		return nil, false
+	}
+	field, ok := elem.FieldByName("Name")
+	if !ok || field.Type.Kind() != reflect.String {
+		return nil, false
+	}
+	if name, _ := jsonName(field); name != "name" {
+		return nil, false
+	}
+
+	keys := make([]string, 0, list.Len())
+	seen := make(map[string]bool, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		key := list.Index(i).FieldByIndex(field.Index).String()
+		if key == "" || seen[key] {
+			return nil, false
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+// jsonName returns the JSON name of a struct field and whether it is inlined.
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	name := strings.Split(tag, ",")[0]
+	if strings.Contains(tag, ",inline") || (field.Anonymous && name == "") {
+		return "", true
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// mapKeys returns the sorted union of the keys of the maps a and b.
+func mapKeys(a, b reflect.Value) []reflect.Value {
+	seen := map[interface{}]bool{}
+	var keys []reflect.Value
+	for _, m := range []reflect.Value{a, b} {
+		for _, k := range m.MapKeys() {
+			if !seen[k.Interface()] {
+				seen[k.Interface()] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+// valueOf returns the value held by v, or nil if v is invalid, a nil pointer or empty.
+func valueOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+	}
+	return v.Interface()
+}
+
+// formatValue returns a compact human-readable form of a changed value.
+func formatValue(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "<none>"
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	}
+	if leafTypes[v.Type()] {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		if stringer, ok := ptr.Interface().(fmt.Stringer); ok {
+			return stringer.String()
+		}
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprint(v.Interface())
+	}
+	return string(data)
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// hasPathPrefix returns true if path is, or is nested below, any of prefixes.
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[") {
+			return true
+		}
+	}
+	return false
+}
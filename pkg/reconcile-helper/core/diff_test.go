@@ -0,0 +1,16 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffDifferentDynamicTypes(t *testing.T) {
+	from := map[string]interface{}{"a": map[string]interface{}{}, "b": []interface{}{"x"}, "c": int64(1)}
+	to := map[string]interface{}{"a": "x", "b": "x", "c": int64(1)}
+
+	changes := Diff("spec", from, to)
+	if want := []string{"spec[a]", "spec[b]"}; !reflect.DeepEqual(changes.Paths(), want) {
+		t.Errorf("Diff() paths = %v, want %v", changes.Paths(), want)
+	}
+}
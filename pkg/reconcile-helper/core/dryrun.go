@@ -0,0 +1,147 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gomodules.xyz/jsonpatch/v2"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// planned fills in the dry-run details of result by computing the JSON patch from
+// before, the live object or nil if it did not exist, to result.Object, or to an empty
+// document if the object was deleted.
+func (o *options) planned(result Result, before client.Object) (Result, error) {
+	if !o.dryRun {
+		return result, nil
+	}
+	result.DryRun = true
+
+	after := result.Object
+	if result.Operation == OperationResultDeleted {
+		after = nil
+	}
+	patch, err := jsonPatch(before, after)
+	if err != nil {
+		return result, errors.Wrap(err, "unable to compute dry-run patch")
+	}
+	result.Patch = patch
+	return result, nil
+}
+
+// jsonPatch returns the JSON patch turning from into to, ignoring fields set by the API server.
+// The values of the redacted fields of the kind of from and to are replaced in the patch, so
+// that e.g. a changed Secret key is listed without its contents.
+func jsonPatch(from, to client.Object) ([]byte, error) {
+	original, err := patchDocument(from)
+	if err != nil {
+		return nil, err
+	}
+	current, err := patchDocument(to)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := jsonpatch.CreatePatch(original, current)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := to
+	if obj == nil {
+		obj = from
+	}
+	if paths := redactedPaths[kindOf(obj)]; len(paths) != 0 {
+		for i := range operations {
+			operations[i].Value = redactOperationValue(operations[i].Path, operations[i].Value, paths)
+		}
+	}
+	return json.Marshal(operations)
+}
+
+// redactOperationValue returns the value of the patch operation at pointer with the values of
+// the given paths, and of all fields nested below them, replaced.
+func redactOperationValue(pointer string, value interface{}, paths []string) interface{} {
+	if value == nil {
+		return nil
+	}
+	var segments []string
+	if pointer != "" {
+		segments = strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	}
+	for _, path := range paths {
+		fields := strings.Split(path, ".")
+		if hasSegmentPrefix(segments, fields) {
+			return redactValues(value)
+		}
+		if !hasSegmentPrefix(fields, segments) {
+			continue
+		}
+		// The operation sets a parent of path, e.g. adds the whole data of a created Secret.
+		parent, ok := value.(map[string]interface{})
+		for _, field := range fields[len(segments) : len(fields)-1] {
+			if !ok {
+				break
+			}
+			parent, ok = parent[field].(map[string]interface{})
+		}
+		if ok {
+			if nested, exists := parent[fields[len(fields)-1]]; exists {
+				parent[fields[len(fields)-1]] = redactValues(nested)
+			}
+		}
+	}
+	return value
+}
+
+// redactValues returns value with all its leaf values replaced by redactedValue.
+func redactValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			redacted[key] = redactValues(nested)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, 0, len(v))
+		for _, nested := range v {
+			redacted = append(redacted, redactValues(nested))
+		}
+		return redacted
+	default:
+		return redactedValue
+	}
+}
+
+// hasSegmentPrefix returns true if segments starts with prefix.
+func hasSegmentPrefix(segments, prefix []string) bool {
+	if len(segments) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if segments[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func patchDocument(obj client.Object) ([]byte, error) {
+	if obj == nil {
+		return []byte("{}"), nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range serverSetPaths {
+		unstructured.RemoveNestedField(content, strings.Split(path, ".")...)
+	}
+	return json.Marshal(content)
+}
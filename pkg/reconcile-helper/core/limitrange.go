@@ -0,0 +1,32 @@
+package core
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LimitRange reconciles a LimitRange object.
+func LimitRange(ctx context.Context, r client.Client, limitRange *corev1.LimitRange, log logr.Logger, opts ...Option) (Result, error) {
+	return Reconcile(ctx, r, limitRange, func(from, to *corev1.LimitRange) bool {
+		return CopyLimitRange(from, to, log)
+	}, append([]Option{WithLogger(log)}, opts...)...)
+}
+
+// CopyLimitRange copies the owned fields from one LimitRange to another
+// Returns true if the fields copied from don't match to.
+func CopyLimitRange(from, to *corev1.LimitRange, log logr.Logger) bool {
+	from = from.DeepCopy()
+	defaultLimitRange(from)
+
+	requireUpdate := false
+	requireUpdate = copyField(log, "LimitRange", "metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyAnnotations(log, "LimitRange", &to.Annotations, from.Annotations) || requireUpdate
+
+	requireUpdate = copyField(log, "LimitRange", "spec.limits", &to.Spec.Limits, from.Spec.Limits) || requireUpdate
+
+	return requireUpdate
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// OwnedLabelsAnnotation lists the label keys set by the last reconcile call using a merging
+	// MetadataPolicy, so that they are removed once they are no longer desired. It is not set if
+	// there are none.
+	OwnedLabelsAnnotation = "reconcile.plural.sh/owned-labels"
+	// OwnedAnnotationsAnnotation lists the annotation keys set by the last reconcile call using a
+	// merging MetadataPolicy, so that they are removed once they are no longer desired. It is not
+	// set if there are none.
+	OwnedAnnotationsAnnotation = "reconcile.plural.sh/owned-annotations"
+)
+
+// MetadataPolicy defines how the labels and annotations of the desired object are reconciled
+// with the ones of the live object.
+type MetadataPolicy string
+
+const (
+	// MetadataPolicyReplace replaces the labels and annotations of the live object with the
+	// desired ones, removing those added by other tools. It is the default.
+	MetadataPolicyReplace MetadataPolicy = "Replace"
+	// MetadataPolicyMerge only manages the desired keys and the keys set by previous reconcile
+	// calls, which are tracked in OwnedLabelsAnnotation and OwnedAnnotationsAnnotation. Keys added
+	// by other tools, e.g. ArgoCD tracking or Istio revision labels, are kept.
+	MetadataPolicyMerge MetadataPolicy = "Merge"
+)
+
+// WithMetadataPolicy sets the policy for reconciling labels and annotations. With
+// MetadataPolicyMerge, keys having one of ownedPrefixes, e.g. "app.plural.sh/", are owned as
+// well: live keys with such a prefix are removed unless they are desired, even if they were
+// never set by a reconcile call.
+func WithMetadataPolicy(policy MetadataPolicy, ownedPrefixes ...string) Option {
+	if policy != MetadataPolicyMerge {
+		return func(*options) {}
+	}
+	return withPrepare(func(ctx context.Context, r client.Client, desired, found client.Object) error {
+		var liveLabels, liveAnnotations map[string]string
+		if found != nil {
+			liveLabels, liveAnnotations = found.GetLabels(), found.GetAnnotations()
+		}
+
+		labels := desired.GetLabels()
+		annotations := desired.GetAnnotations()
+		ownedLabels := ownedKeys(liveAnnotations, OwnedLabelsAnnotation)
+		ownedAnnotations := ownedKeys(liveAnnotations, OwnedAnnotationsAnnotation)
+		delete(annotations, OwnedLabelsAnnotation)
+		delete(annotations, OwnedAnnotationsAnnotation)
+
+		mergedLabels := mergeMetadata(liveLabels, labels, ownedLabels, ownedPrefixes)
+		mergedAnnotations := mergeMetadata(liveAnnotations, annotations, ownedAnnotations, ownedPrefixes)
+		// The tracking annotations are left out while there is nothing to track.
+		if len(labels) != 0 {
+			mergedAnnotations[OwnedLabelsAnnotation] = joinKeys(labels)
+		}
+		if len(annotations) != 0 {
+			mergedAnnotations[OwnedAnnotationsAnnotation] = joinKeys(annotations)
+		}
+
+		desired.SetLabels(mergedLabels)
+		desired.SetAnnotations(mergedAnnotations)
+		return nil
+	})
+}
+
+// mergeMetadata returns the live keys that are not owned, overlaid with the wanted keys.
+// A key is owned if it was set before, i.e. is in owned, or has one of ownedPrefixes.
+func mergeMetadata(live, wanted map[string]string, owned map[string]bool, ownedPrefixes []string) map[string]string {
+	merged := make(map[string]string, len(live)+len(wanted))
+	for key, value := range live {
+		if key == OwnedLabelsAnnotation || key == OwnedAnnotationsAnnotation {
+			continue
+		}
+		if owned[key] || hasKeyPrefix(key, ownedPrefixes) {
+			continue
+		}
+		merged[key] = value
+	}
+	for key, value := range wanted {
+		merged[key] = value
+	}
+	return merged
+}
+
+// ownedKeys returns the keys tracked in the annotation key of annotations.
+func ownedKeys(annotations map[string]string, key string) map[string]bool {
+	owned := map[string]bool{}
+	value, ok := annotations[key]
+	if !ok || value == "" {
+		return owned
+	}
+	for _, k := range strings.Split(value, ",") {
+		owned[k] = true
+	}
+	return owned
+}
+
+// joinKeys returns the sorted, comma separated keys of m.
+func joinKeys(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func hasKeyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoredAnnotations lists the annotations that are set by the API server, built-in controllers
+// or client tools and are therefore kept on the live object when they are not desired, e.g. the
+// revision annotation of a Deployment. Entries ending with "/" match all keys with that prefix.
+// Further entries can be added for all reconcile calls, or per call using WithIgnoredAnnotations.
+var IgnoredAnnotations = []string{
+	"deployment.kubernetes.io/",
+	"pv.kubernetes.io/",
+	"volume.kubernetes.io/",
+	"volume.beta.kubernetes.io/",
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"kubernetes.io/service-account.uid",
+	"control-plane.alpha.kubernetes.io/leader",
+}
+
+// WithIgnoredAnnotations keeps the live values of the given annotations in addition to
+// IgnoredAnnotations. Entries ending with "/" match all keys with that prefix.
+func WithIgnoredAnnotations(keys ...string) Option {
+	return withPrepare(func(ctx context.Context, r client.Client, desired, found client.Object) error {
+		if found == nil {
+			return nil
+		}
+		annotations := desired.GetAnnotations()
+		for key, value := range found.GetAnnotations() {
+			if _, ok := annotations[key]; ok || !matchesKey(key, keys) {
+				continue
+			}
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[key] = value
+		}
+		desired.SetAnnotations(annotations)
+		return nil
+	})
+}
+
+// copyAnnotations copies the wanted annotations of kind into existing, keeping the
+// annotations matching IgnoredAnnotations that are not wanted.
+// Returns true if the annotations copied from don't match to.
+func copyAnnotations(log logr.Logger, kind string, existing *map[string]string, wanted map[string]string) bool {
+	annotations := make(map[string]string, len(wanted))
+	for key, value := range *existing {
+		if matchesKey(key, IgnoredAnnotations) {
+			annotations[key] = value
+		}
+	}
+	for key, value := range wanted {
+		annotations[key] = value
+	}
+	if len(annotations) == 0 {
+		annotations = wanted
+	}
+	return copyField(log, kind, "metadata.annotations", existing, annotations)
+}
+
+// matchesKey returns true if key is one of keys or has one of the keys ending with "/" as prefix.
+func matchesKey(key string, keys []string) bool {
+	for _, k := range keys {
+		if key == k || (strings.HasSuffix(k, "/") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+	return false
+}
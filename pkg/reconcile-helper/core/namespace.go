@@ -4,89 +4,55 @@ import (
 	"context"
 	"time"
 
-	"github.com/cenkalti/backoff"
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 
 	corev1 "k8s.io/api/core/v1"
-	apierrs "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// Namespace reconciles a Namespace object.
-func Namespace(ctx context.Context, r client.Client, namespace *corev1.Namespace, log logr.Logger) error {
-	foundNamespace := &corev1.Namespace{}
-	justCreated := false
-	if err := r.Get(ctx, types.NamespacedName{Name: namespace.Name, Namespace: namespace.Namespace}, foundNamespace); err != nil {
-		if apierrs.IsNotFound(err) {
-			log.Info("Creating Namespace", "namespace", namespace.Name)
-			if err = r.Create(ctx, namespace); err != nil {
-				// IncRequestErrorCounter("error creating namespace", SEVERITY_MAJOR)
-				log.Error(err, "Unable to create Namespace")
-				return err
-			}
-			err = backoff.Retry(
-				func() error {
-					return r.Get(ctx, types.NamespacedName{Name: namespace.Name}, foundNamespace)
-				},
-				backoff.WithMaxRetries(backoff.NewConstantBackOff(3*time.Second), 5))
-			if err != nil {
-				// IncRequestErrorCounter("error namespace create completion", SEVERITY_MAJOR)
-				log.Error(err, "Error Namespace create completion")
-				return err
-				// return r.appendErrorConditionAndReturn(ctx, namespace,
-				// "Owning namespace failed to create within 15 seconds")
-			}
-			log.Info("Created Namespace: "+foundNamespace.Name, "status", foundNamespace.Status.Phase)
-			justCreated = true
-		} else {
-			// IncRequestErrorCounter("error getting Namespace", SEVERITY_MAJOR)
-			log.Error(err, "Error getting Namespace")
-			return err
-		}
-	}
-	if !justCreated && CopyNamespace(namespace, foundNamespace, log) {
-		log.Info("Updating Namespace", "namespace", namespace.Name)
-		if err := r.Update(ctx, foundNamespace); err != nil {
-			log.Error(err, "Unable to update Namespace")
-			return err
+// ErrNamespaceTerminating is returned when the namespace being reconciled is terminating.
+var ErrNamespaceTerminating = errors.New("namespace is terminating")
+
+// NamespaceRequeueAfter is the delay after which a caller should reconcile again
+// while a namespace is not active yet.
+var NamespaceRequeueAfter = 2 * time.Second
+
+// Namespace reconciles a Namespace object without waiting for it to become active. While it is
+// not active, e.g. right after it was created, the returned Result has RequeueAfter set. If the
+// namespace is terminating it is left untouched and an error wrapping ErrNamespaceTerminating is
+// returned, so the caller can wait for the deletion to finish before recreating it.
+func Namespace(ctx context.Context, r client.Client, namespace *corev1.Namespace, log logr.Logger, opts ...Option) (Result, error) {
+	// Namespaces are cluster scoped, a namespace set by mistake would break the lookup.
+	namespace.Namespace = ""
+	result, err := Reconcile(ctx, r, namespace, func(from, to *corev1.Namespace) bool {
+		return CopyNamespace(from, to, log)
+	}, append([]Option{WithLogger(log), withPrepare(func(ctx context.Context, r client.Client, desired, found client.Object) error {
+		if found != nil && found.(*corev1.Namespace).Status.Phase == corev1.NamespaceTerminating {
+			return ErrNamespaceTerminating
 		}
+		return nil
+	})}, opts...)...)
+	if err != nil || result.DryRun {
+		return result, err
 	}
 
-	return nil
+	if phase := result.Object.(*corev1.Namespace).Status.Phase; phase != corev1.NamespaceActive {
+		log.V(1).Info("Namespace is not active yet", "name", namespace.Name, "phase", phase)
+		result.RequeueAfter = NamespaceRequeueAfter
+	}
+	return result, nil
 }
 
 // CopyNamespace copies the owned fields from one Namespace to another
 // Returns true if the fields copied from don't match to.
 func CopyNamespace(from, to *corev1.Namespace, log logr.Logger) bool {
-	requireUpdate := false
-	for k, v := range to.Labels {
-		if from.Labels[k] != v {
-			log.V(1).Info("reconciling Namespace due to label change")
-			log.V(2).Info("difference in Namespace labels", "wanted", from.Labels, "existing", to.Labels)
-			requireUpdate = true
-		}
-	}
-	if len(to.Labels) == 0 && len(from.Labels) != 0 {
-		log.V(1).Info("reconciling Namespace due to label change")
-		log.V(2).Info("difference in Namespace labels", "wanted", from.Labels, "existing", to.Labels)
-		requireUpdate = true
-	}
-	to.Labels = from.Labels
+	from = from.DeepCopy()
+	defaultNamespace(from)
 
-	for k, v := range to.Annotations {
-		if from.Annotations[k] != v {
-			log.V(1).Info("reconciling Namespace due to annotation change")
-			log.V(2).Info("difference in Namespace annotations", "wanted", from.Annotations, "existing", to.Annotations)
-			requireUpdate = true
-		}
-	}
-	if len(to.Annotations) == 0 && len(from.Annotations) != 0 {
-		log.V(1).Info("reconciling Namespace due to annotation change")
-		log.V(2).Info("difference in Namespace annotations", "wanted", from.Annotations, "existing", to.Annotations)
-		requireUpdate = true
-	}
-	to.Annotations = from.Annotations
+	requireUpdate := false
+	requireUpdate = copyField(log, "Namespace", "metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyAnnotations(log, "Namespace", &to.Annotations, from.Annotations) || requireUpdate
 
 	return requireUpdate
 }
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Option configures a single reconcile call.
+type Option func(*options)
+
+// options contains the settings a reconcile call was made with.
+type options struct {
+	log *logr.Logger
+
+	fieldManager   string
+	forceOwnership bool
+
+	owner  client.Object
+	scheme *runtime.Scheme
+
+	managedBy       string
+	adoptLabelKey   string
+	adoptLabelValue string
+
+	dryRun bool
+
+	recreate       bool
+	recreateNow    bool
+	immutable      immutableFn
+	beforeRecreate beforeRecreateFn
+	expandClaims   bool
+
+	prepare []prepareFn
+
+	clock clock.PassiveClock
+}
+
+// WithLogger sets the logger used to report what the reconcile call did.
+// When no logger is given the logger stored in the context is used.
+func WithLogger(log logr.Logger) Option {
+	return func(o *options) {
+		o.log = &log
+	}
+}
+
+// WithServerSideApply reconciles the object using a server-side apply patch owned by
+// fieldManager instead of updating a mutated copy of the live object. Only the fields set
+// on the desired object are managed, so fields owned by other controllers (e.g. replicas
+// managed by an autoscaler or sidecars injected by a webhook) are left alone.
+func WithServerSideApply(fieldManager string) Option {
+	return func(o *options) {
+		o.fieldManager = fieldManager
+	}
+}
+
+// WithForceOwnership makes a server-side apply take ownership of fields that are
+// currently owned by another field manager instead of failing with a conflict.
+func WithForceOwnership() Option {
+	return func(o *options) {
+		o.forceOwnership = true
+	}
+}
+
+// WithOwner makes owner the controller of the reconciled object. The controller reference
+// is set when the object is created and repaired when it is updated. If the live object
+// is already controlled by a different owner it is left untouched and a
+// *controllerutil.AlreadyOwnedError is returned.
+func WithOwner(owner client.Object, scheme *runtime.Scheme) Option {
+	return func(o *options) {
+		o.owner = owner
+		o.scheme = scheme
+	}
+}
+
+// WithManagedBy enables ownership protection. The object is labelled with
+// ManagedByLabel=manager when it is created, and an existing object is only
+// updated if it carries that label or is controlled by the owner given with
+// WithOwner. Otherwise an error wrapping ErrNotOwned is returned, so a
+// pre-existing object with the same name is never overwritten.
+func WithManagedBy(manager string) Option {
+	return func(o *options) {
+		o.managedBy = manager
+	}
+}
+
+// WithAdoptOnLabel lets WithManagedBy adopt existing objects that are not managed yet
+// but carry the label key=value, e.g. because a user explicitly handed them over.
+func WithAdoptOnLabel(key, value string) Option {
+	return func(o *options) {
+		o.adoptLabelKey = key
+		o.adoptLabelValue = value
+	}
+}
+
+// WithDryRun runs the reconcile call in plan mode: all writes are sent with
+// client.DryRunAll, so the API server validates and defaults them without
+// persisting anything, and the returned Result carries a JSON patch of the change.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithRecreateOnImmutableChange makes a reconcile call delete the live object when the
+// desired object changes one of its immutable fields, e.g. the selector of a Deployment,
+// instead of returning an error wrapping ErrImmutableFieldChanged. The object is deleted
+// with orphan propagation so its pods keep running until the new object adopts them. If
+// the selector changed the new object would never adopt them, so its dependents, e.g. the
+// ReplicaSets and pods of a Deployment, are deleted with it instead. The returned Result
+// has RequeueAfter set so the caller reconciles again to create the new object. Objects
+// that are in use while they don't exist, such as Secrets mounted by pods, are created
+// again right away by the same call instead.
+func WithRecreateOnImmutableChange() Option {
+	return func(o *options) {
+		o.recreate = true
+	}
+}
+
+// WithClaimExpansion makes a StatefulSet that is recreated because its volume claim
+// templates changed expand the existing PersistentVolumeClaims of its pods to the storage
+// requested by the new templates first, as the StatefulSet controller never updates them.
+// If a claim can't be expanded as its StorageClass does not allow it, the StatefulSet is not
+// recreated and an error wrapping ErrClaimExpansionNotAllowed is returned.
+// It has no effect without WithRecreateOnImmutableChange.
+func WithClaimExpansion() Option {
+	return func(o *options) {
+		o.expandClaims = true
+	}
+}
+
+// WithClock sets the clock used by time based helpers such as TLSSecret, e.g. a
+// k8s.io/utils/clock/testing.FakeClock in tests. The real clock is used by default.
+func WithClock(clock clock.PassiveClock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// prepareFn adjusts desired to the live object found, which is nil if it does not exist yet,
+// before the two are compared, e.g. to keep the live value of a field that must not change.
+type prepareFn func(ctx context.Context, r client.Client, desired, found client.Object) error
+
+// withPrepare adds a function that adjusts the desired object before it is reconciled.
+// It is set by the kind specific helpers whose desired state depends on the cluster.
+func withPrepare(fn prepareFn) Option {
+	return func(o *options) {
+		o.prepare = append(o.prepare, fn)
+	}
+}
+
+// withoutNamespacedOwner drops an owner set with WithOwner that is namespaced, as it can't be
+// the owner of a cluster-scoped object. It is used by helpers that reconcile cluster-scoped
+// objects with the options given for namespaced ones and has to follow them.
+func withoutNamespacedOwner() Option {
+	return func(o *options) {
+		if o.owner != nil && o.owner.GetNamespace() != "" {
+			o.owner = nil
+		}
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// logger returns the configured logger, falling back to the one stored in ctx.
+func (o *options) logger(ctx context.Context) logr.Logger {
+	log := ctrllog.FromContext(ctx)
+	if o.log != nil {
+		log = *o.log
+	}
+	if o.dryRun {
+		log = log.WithValues("dryRun", true)
+	}
+	return log
+}
+
+// now returns the current time of the configured clock.
+func (o *options) now() time.Time {
+	if o.clock == nil {
+		return time.Now()
+	}
+	return o.clock.Now()
+}
+
+func (o *options) createOptions() []client.CreateOption {
+	if o.dryRun {
+		return []client.CreateOption{client.DryRunAll}
+	}
+	return nil
+}
+
+func (o *options) updateOptions() []client.UpdateOption {
+	if o.dryRun {
+		return []client.UpdateOption{client.DryRunAll}
+	}
+	return nil
+}
+
+func (o *options) deleteOptions(propagation metav1.DeletionPropagation) []client.DeleteOption {
+	opts := []client.DeleteOption{client.PropagationPolicy(propagation)}
+	if o.dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+	return opts
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// setOwner sets the configured owner as the controller of obj, repairing
+// the controller reference if it is missing or outdated.
+func (o *options) setOwner(obj client.Object) error {
+	if o.owner == nil {
+		return nil
+	}
+	return controllerutil.SetControllerReference(o.owner, obj, o.scheme)
+}
+
+// checkOwner returns a *controllerutil.AlreadyOwnedError if obj is
+// controlled by an object other than the configured owner.
+func (o *options) checkOwner(obj client.Object) error {
+	if o.owner == nil {
+		return nil
+	}
+	return controllerutil.SetControllerReference(o.owner, obj.DeepCopyObject().(client.Object), o.scheme)
+}
+
+// ManagedByLabel is the label used by WithManagedBy to mark the objects a controller manages.
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+// ErrNotOwned is returned when WithManagedBy is set and the live object is not managed by this controller.
+var ErrNotOwned = errors.New("object is not owned by this controller")
+
+// checkManaged returns an error wrapping ErrNotOwned if ownership protection is
+// enabled and obj is neither managed by this controller, controlled by the
+// configured owner nor labelled for adoption.
+func (o *options) checkManaged(obj client.Object) error {
+	if o.managedBy == "" {
+		return nil
+	}
+
+	labels := obj.GetLabels()
+	if labels[ManagedByLabel] == o.managedBy {
+		return nil
+	}
+	if o.owner != nil {
+		if ref := metav1.GetControllerOf(obj); ref != nil && ref.UID == o.owner.GetUID() {
+			return nil
+		}
+	}
+	if o.adoptLabelKey != "" {
+		if value, ok := labels[o.adoptLabelKey]; ok && value == o.adoptLabelValue {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrNotOwned, "expected label %s=%s", ManagedByLabel, o.managedBy)
+}
+
+// setManagedBy labels obj as managed by this controller if ownership protection is enabled.
+func (o *options) setManagedBy(obj client.Object) {
+	if o.managedBy == "" || obj.GetLabels()[ManagedByLabel] == o.managedBy {
+		return
+	}
+	labels := make(map[string]string, len(obj.GetLabels())+1)
+	for k, v := range obj.GetLabels() {
+		labels[k] = v
+	}
+	labels[ManagedByLabel] = o.managedBy
+	obj.SetLabels(labels)
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// copyPodTemplate copies the owned fields of a pod template, path is the path of the
+// template within kind, e.g. "spec.template". from is expected to have the API server
+// defaults applied, see defaultPodSpec.
+// Returns true if the fields copied from don't match to.
+func copyPodTemplate(log logr.Logger, kind, path string, from *corev1.PodTemplateSpec, to *corev1.PodTemplateSpec) bool {
+	requireUpdate := false
+	requireUpdate = copyField(log, kind, path+".metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyField(log, kind, path+".metadata.annotations", &to.Annotations, from.Annotations) || requireUpdate
+
+	spec := path + ".spec"
+	volumes := withInjectedVolumes(from.Spec.Volumes, to.Spec.Volumes, injectedContainers(from.Spec, to.Spec))
+	requireUpdate = copyField(log, kind, spec+".volumes", &to.Spec.Volumes, volumes) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".serviceAccountName", &to.Spec.ServiceAccountName, from.Spec.ServiceAccountName) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".securityContext", &to.Spec.SecurityContext, from.Spec.SecurityContext) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".imagePullSecrets", &to.Spec.ImagePullSecrets, from.Spec.ImagePullSecrets) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".terminationGracePeriodSeconds", &to.Spec.TerminationGracePeriodSeconds, from.Spec.TerminationGracePeriodSeconds) || requireUpdate
+
+	requireUpdate = copyField(log, kind, spec+".nodeSelector", &to.Spec.NodeSelector, from.Spec.NodeSelector) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".affinity", &to.Spec.Affinity, from.Spec.Affinity) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".tolerations", &to.Spec.Tolerations, from.Spec.Tolerations) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".topologySpreadConstraints", &to.Spec.TopologySpreadConstraints, from.Spec.TopologySpreadConstraints) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".priorityClassName", &to.Spec.PriorityClassName, from.Spec.PriorityClassName) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".runtimeClassName", &to.Spec.RuntimeClassName, from.Spec.RuntimeClassName) || requireUpdate
+
+	requireUpdate = copyField(log, kind, spec+".hostNetwork", &to.Spec.HostNetwork, from.Spec.HostNetwork) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".dnsPolicy", &to.Spec.DNSPolicy, from.Spec.DNSPolicy) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".dnsConfig", &to.Spec.DNSConfig, from.Spec.DNSConfig) || requireUpdate
+	requireUpdate = copyField(log, kind, spec+".hostAliases", &to.Spec.HostAliases, from.Spec.HostAliases) || requireUpdate
+
+	requireUpdate = copyContainers(log, kind, spec+".initContainers", from.Spec.InitContainers, &to.Spec.InitContainers) || requireUpdate
+	requireUpdate = copyContainers(log, kind, spec+".containers", from.Spec.Containers, &to.Spec.Containers) || requireUpdate
+	return requireUpdate
+}
+
+// injectedContainers returns the containers and init containers of the live pod spec that
+// are kept by copyContainers although they are not wanted, see InjectedContainers.
+func injectedContainers(from, to corev1.PodSpec) []corev1.Container {
+	wanted := map[string]bool{}
+	for _, containers := range [][]corev1.Container{from.InitContainers, from.Containers} {
+		for _, container := range containers {
+			wanted[container.Name] = true
+		}
+	}
+	var injected []corev1.Container
+	for _, containers := range [][]corev1.Container{to.InitContainers, to.Containers} {
+		for _, container := range containers {
+			if !wanted[container.Name] && isInjectedContainer(container.Name) {
+				injected = append(injected, container)
+			}
+		}
+	}
+	return injected
+}
+
+// withInjectedVolumes returns the wanted volumes together with the live volumes that the
+// injected containers mount and that are not wanted, so that the kept containers don't refer
+// to missing volumes. The live volumes keep their position so they don't cause a reorder.
+func withInjectedVolumes(wanted, live []corev1.Volume, injected []corev1.Container) []corev1.Volume {
+	mounted := map[string]bool{}
+	for _, container := range injected {
+		for _, mount := range container.VolumeMounts {
+			mounted[mount.Name] = true
+		}
+		for _, device := range container.VolumeDevices {
+			mounted[device.Name] = true
+		}
+	}
+	if len(mounted) == 0 {
+		return wanted
+	}
+	for _, volume := range wanted {
+		delete(mounted, volume.Name)
+	}
+
+	volumes := append([]corev1.Volume(nil), wanted...)
+	for i, volume := range live {
+		if !mounted[volume.Name] {
+			continue
+		}
+		position := i
+		if position > len(volumes) {
+			position = len(volumes)
+		}
+		volumes = append(volumes[:position], append([]corev1.Volume{volume}, volumes[position:]...)...)
+	}
+	return volumes
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	networkv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pluralsh/controller-reconcile-helper/pkg/conditions"
+	crhelpertypes "github.com/pluralsh/controller-reconcile-helper/pkg/types"
+)
+
+const (
+	// NamespaceProfileReasonNamespaceNotActive means the namespace of a profile is not active yet.
+	NamespaceProfileReasonNamespaceNotActive = "NamespaceNotActive"
+	// NamespaceProfileReasonReconcileFailed means the namespace or a member of a profile could not be reconciled.
+	NamespaceProfileReasonReconcileFailed = "ReconcileFailed"
+)
+
+// NamespaceProfile is the declarative bundle of a namespace and the objects every namespace
+// of its kind, e.g. a tenant namespace, contains. Members without a namespace are placed in it.
+type NamespaceProfile struct {
+	Namespace *corev1.Namespace
+
+	ResourceQuotas  []*corev1.ResourceQuota
+	LimitRanges     []*corev1.LimitRange
+	NetworkPolicies []*networkv1.NetworkPolicy
+	RoleBindings    []*rbacv1.RoleBinding
+}
+
+// NamespaceProfileMember is the outcome of reconciling a single member of a NamespaceProfile.
+type NamespaceProfileMember struct {
+	// Kind and Name identify the member.
+	Kind string
+	Name string
+
+	// Result is what the reconcile call did to the member.
+	Result Result
+
+	// Err is the error reconciling the member failed with, if any.
+	Err error
+}
+
+// NamespaceProfileResult describes what a reconcile call did to a NamespaceProfile.
+type NamespaceProfileResult struct {
+	// Namespace is what the reconcile call did to the namespace.
+	Namespace Result
+
+	// Members lists the outcome for every member, in the order the profile declares them.
+	// It is empty if the namespace could not be reconciled or is not active yet.
+	Members []NamespaceProfileMember
+
+	// RequeueAfter is set when the caller should reconcile again, e.g. because the namespace is not active yet.
+	RequeueAfter time.Duration
+
+	// Err is the aggregated error of the namespace and all members.
+	Err error
+}
+
+// Condition returns a condition of type t that is true if the namespace is active and all
+// members were reconciled, false with Severity=Info while the namespace is not active yet and
+// false with Severity=Error listing the failures otherwise.
+func (r NamespaceProfileResult) Condition(t crhelpertypes.ConditionType) *crhelpertypes.Condition {
+	if r.Err != nil {
+		return conditions.FalseCondition(t, NamespaceProfileReasonReconcileFailed, crhelpertypes.ConditionSeverityError, "%s", r.Err.Error())
+	}
+	if r.RequeueAfter != 0 && len(r.Members) == 0 {
+		return conditions.FalseCondition(t, NamespaceProfileReasonNamespaceNotActive, crhelpertypes.ConditionSeverityInfo, "waiting for namespace to become active")
+	}
+	return conditions.TrueCondition(t)
+}
+
+// ReconcileNamespaceProfile reconciles the namespace of profile and, once it is active, all
+// members of profile using the kind specific helpers of this package, each called with opts.
+// A namespaced owner given with WithOwner only owns the members, as a Namespace is cluster
+// scoped and can't have one. Under WithDryRun the members of a namespace that doesn't exist
+// yet are reported as planned creates. A failing member does not prevent the others from
+// being reconciled; all errors are aggregated in the returned error, which is also stored in
+// NamespaceProfileResult.Err.
+func ReconcileNamespaceProfile(ctx context.Context, r client.Client, profile *NamespaceProfile, log logr.Logger, opts ...Option) (NamespaceProfileResult, error) {
+	var result NamespaceProfileResult
+	namespace, err := Namespace(ctx, r, profile.Namespace, log, append(opts[:len(opts):len(opts)], withoutNamespacedOwner())...)
+	result.Namespace = namespace
+	if err != nil {
+		result.Err = err
+		return result, err
+	}
+	result.RequeueAfter = namespace.RequeueAfter
+	if namespace.RequeueAfter != 0 {
+		return result, nil
+	}
+
+	// A namespace that doesn't exist yet is not created by a dry-run call, so the dry-run
+	// creates of its members would fail; they are planned without calling the API server.
+	o := newOptions(opts...)
+	planOnly := namespace.DryRun && namespace.Operation == OperationResultCreated
+	name := profile.Namespace.Name
+	add := func(obj client.Object, reconcile func() (Result, error)) {
+		if planOnly {
+			reconcile = func() (Result, error) {
+				return plannedCreate(obj, log, o)
+			}
+		}
+		result.add(kindOf(obj), inNamespace(obj, name), reconcile)
+	}
+	for _, quota := range profile.ResourceQuotas {
+		add(quota, func() (Result, error) {
+			return ResourceQuota(ctx, r, quota, log, opts...)
+		})
+	}
+	for _, limitRange := range profile.LimitRanges {
+		add(limitRange, func() (Result, error) {
+			return LimitRange(ctx, r, limitRange, log, opts...)
+		})
+	}
+	for _, networkPolicy := range profile.NetworkPolicies {
+		add(networkPolicy, func() (Result, error) {
+			return NetworkPolicy(ctx, r, networkPolicy, log, opts...)
+		})
+	}
+	for _, roleBinding := range profile.RoleBindings {
+		add(roleBinding, func() (Result, error) {
+			return RoleBinding(ctx, r, roleBinding, log, opts...)
+		})
+	}
+
+	var errs []error
+	for _, member := range result.Members {
+		if member.Err != nil {
+			errs = append(errs, member.Err)
+		}
+		if member.Result.RequeueAfter != 0 && (result.RequeueAfter == 0 || member.Result.RequeueAfter < result.RequeueAfter) {
+			result.RequeueAfter = member.Result.RequeueAfter
+		}
+	}
+	result.Err = utilerrors.NewAggregate(errs)
+	return result, result.Err
+}
+
+// add reconciles a member of a profile and records the outcome.
+func (r *NamespaceProfileResult) add(kind, name string, reconcile func() (Result, error)) {
+	result, err := reconcile()
+	r.Members = append(r.Members, NamespaceProfileMember{Kind: kind, Name: name, Result: result, Err: err})
+}
+
+// plannedCreate returns the Result of a dry-run call creating obj without calling the API server.
+func plannedCreate(obj client.Object, log logr.Logger, o *options) (Result, error) {
+	kind := kindOf(obj)
+	o.setManagedBy(obj)
+	if err := o.setOwner(obj); err != nil {
+		return Result{}, errors.Wrapf(err, "unable to set owner of %s %s", kind, client.ObjectKeyFromObject(obj))
+	}
+	log.Info("Creating "+kind, append(keysAndValues(obj), "dryRun", true)...)
+	return o.planned(Result{Operation: OperationResultCreated, Object: obj}, nil)
+}
+
+// inNamespace places obj in namespace unless it already has one and returns its name.
+func inNamespace(obj client.Object, namespace string) string {
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(namespace)
+	}
+	return obj.GetName()
+}
+
+// DefaultDenyNetworkPolicy returns a NetworkPolicy selecting all pods of namespace that denies
+// all traffic of the given policy types, ingress only if none are given.
+func DefaultDenyNetworkPolicy(namespace string, policyTypes ...networkv1.PolicyType) *networkv1.NetworkPolicy {
+	if len(policyTypes) == 0 {
+		policyTypes = []networkv1.PolicyType{networkv1.PolicyTypeIngress}
+	}
+	names := make([]string, 0, len(policyTypes))
+	for _, policyType := range policyTypes {
+		names = append(names, strings.ToLower(string(policyType)))
+	}
+	return &networkv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("default-deny-%s", strings.Join(names, "-")),
+			Namespace: namespace,
+		},
+		Spec: networkv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: policyTypes,
+		},
+	}
+}
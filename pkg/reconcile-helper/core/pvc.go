@@ -2,82 +2,199 @@ package core
 
 import (
 	"context"
-	"reflect"
 
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pluralsh/controller-reconcile-helper/pkg/conditions"
+	crhelpertypes "github.com/pluralsh/controller-reconcile-helper/pkg/types"
 )
 
-// PersistentVolumeClaim reconciles a k8s pvc object.
-func PersistentVolumeClaim(ctx context.Context, r client.Client, pvc *corev1.PersistentVolumeClaim, log logr.Logger) error {
-	foundPVC := &corev1.PersistentVolumeClaim{}
-	justCreated := false
-	if err := r.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, foundPVC); err != nil {
-		if apierrs.IsNotFound(err) {
-			log.Info("Creating PersistentVolumeClaim", "namespace", pvc.Namespace, "name", pvc.Name)
-			if err := r.Create(ctx, pvc); err != nil {
-				log.Error(err, "Unable to create PersistentVolumeClaim")
-				return err
-			}
-			justCreated = true
-		} else {
-			log.Error(err, "Error getting PersistentVolumeClaim")
-			return err
+// ResizeState is the state of the expansion of a PersistentVolumeClaim.
+type ResizeState string
+
+const (
+	// ResizeStateNone means the claim has the requested size, or it is not bound yet.
+	ResizeStateNone ResizeState = "None"
+	// ResizeStateInProgress means the volume is being expanded by the storage provider.
+	ResizeStateInProgress ResizeState = "InProgress"
+	// ResizeStateFileSystemResizePending means the volume was expanded and the file system
+	// is resized once a pod using the claim is (re)started.
+	ResizeStateFileSystemResizePending ResizeState = "FileSystemResizePending"
+	// ResizeStateRefused means the requested size was not applied, see ResizeStatus.Reason.
+	ResizeStateRefused ResizeState = "Refused"
+)
+
+const (
+	// ResizeReasonShrinkNotSupported is the reason a claim is not resized to a smaller size.
+	ResizeReasonShrinkNotSupported = "ShrinkNotSupported"
+	// ResizeReasonExpansionNotAllowed is the reason a claim is not expanded when its
+	// StorageClass does not set allowVolumeExpansion.
+	ResizeReasonExpansionNotAllowed = "ExpansionNotAllowed"
+)
+
+// ResizeStatus describes the expansion of a PersistentVolumeClaim.
+type ResizeStatus struct {
+	// State is the state of the expansion.
+	State ResizeState
+
+	// Reason is set when the expansion was refused, e.g. ResizeReasonShrinkNotSupported.
+	Reason string
+
+	// Message is a human-readable description of the state.
+	Message string
+
+	// Requested is the storage requested by the desired claim.
+	Requested resource.Quantity
+
+	// Capacity is the storage currently provided by the bound volume.
+	Capacity resource.Quantity
+}
+
+// Condition returns a condition of type t reflecting the resize status. It is true if
+// the claim has the requested size and false with Severity=Info while it is being
+// expanded, or Severity=Warning if the expansion was refused.
+func (s ResizeStatus) Condition(t crhelpertypes.ConditionType) *crhelpertypes.Condition {
+	switch s.State {
+	case ResizeStateInProgress, ResizeStateFileSystemResizePending:
+		return conditions.FalseCondition(t, string(s.State), crhelpertypes.ConditionSeverityInfo, "%s", s.Message)
+	case ResizeStateRefused:
+		return conditions.FalseCondition(t, s.Reason, crhelpertypes.ConditionSeverityWarning, "%s", s.Message)
+	default:
+		return conditions.TrueCondition(t)
+	}
+}
+
+// PersistentVolumeClaimResult describes what a reconcile call did to a PersistentVolumeClaim.
+type PersistentVolumeClaimResult struct {
+	Result
+
+	// Resize is the status of the expansion of the claim.
+	Resize ResizeStatus
+}
+
+// PersistentVolumeClaim reconciles a k8s pvc object. The storage request of an existing claim
+// is only increased if the StorageClass of the claim allows volume expansion and is never
+// decreased, as the API server rejects both; instead the live request is kept and the returned
+// ResizeStatus explains why.
+func PersistentVolumeClaim(ctx context.Context, r client.Client, pvc *corev1.PersistentVolumeClaim, log logr.Logger, opts ...Option) (PersistentVolumeClaimResult, error) {
+	resize := ResizeStatus{State: ResizeStateNone, Requested: pvc.Spec.Resources.Requests[corev1.ResourceStorage]}
+	result, err := Reconcile(ctx, r, pvc, func(from, to *corev1.PersistentVolumeClaim) bool {
+		return CopyPersistentVolumeClaim(from, to, log)
+	}, append([]Option{WithLogger(log), withPrepare(func(ctx context.Context, r client.Client, desired, found client.Object) error {
+		if found == nil {
+			return nil
 		}
+		var err error
+		resize, err = checkResize(ctx, r, desired.(*corev1.PersistentVolumeClaim), found.(*corev1.PersistentVolumeClaim), log)
+		return err
+	})}, opts...)...)
+	if err != nil {
+		return PersistentVolumeClaimResult{}, err
+	}
+
+	if resize.State != ResizeStateRefused {
+		resize = resizeProgress(result.Object.(*corev1.PersistentVolumeClaim), resize.Requested)
 	}
-	if !justCreated && CopyPersistentVolumeClaim(pvc, foundPVC, log) {
-		log.Info("Updating PersistentVolumeClaim", "namespace", pvc.Namespace, "name", pvc.Name)
-		if err := r.Update(ctx, foundPVC); err != nil {
-			log.Error(err, "Unable to update PersistentVolumeClaim")
-			return err
+	return PersistentVolumeClaimResult{Result: result, Resize: resize}, nil
+}
+
+// checkResize returns whether the storage request of the live claim found can be changed to the
+// one of desired. If it can't, the live request is kept on desired and the refusal is returned.
+func checkResize(ctx context.Context, r client.Client, desired, found *corev1.PersistentVolumeClaim, log logr.Logger) (ResizeStatus, error) {
+	wanted, ok := desired.Spec.Resources.Requests[corev1.ResourceStorage]
+	current, exists := found.Spec.Resources.Requests[corev1.ResourceStorage]
+	status := ResizeStatus{State: ResizeStateNone, Requested: wanted, Capacity: found.Status.Capacity[corev1.ResourceStorage]}
+	if !ok || !exists || wanted.Cmp(current) == 0 {
+		return status, nil
+	}
+
+	if wanted.Cmp(current) < 0 {
+		status.State = ResizeStateRefused
+		status.Reason = ResizeReasonShrinkNotSupported
+		status.Message = "cannot shrink claim from " + current.String() + " to " + wanted.String()
+	} else {
+		allowed, err := allowsVolumeExpansion(ctx, r, found.Spec.StorageClassName)
+		if err != nil {
+			return status, err
+		}
+		if allowed {
+			return status, nil
 		}
+		status.State = ResizeStateRefused
+		status.Reason = ResizeReasonExpansionNotAllowed
+		status.Message = "storage class of claim does not allow expanding it from " + current.String() + " to " + wanted.String()
 	}
 
-	return nil
+	log.Info("Refusing to resize PersistentVolumeClaim", "namespace", found.Namespace, "name", found.Name, "reason", status.Reason, "from", current.String(), "to", wanted.String())
+	desired.Spec.Resources.Requests = desired.Spec.Resources.Requests.DeepCopy()
+	desired.Spec.Resources.Requests[corev1.ResourceStorage] = current
+	return status, nil
 }
 
-// CopyPersistentVolumeClaim copies the owned fields from one PersistentVolumeClaim to another
-// Returns true if the fields copied from don't match to.
-func CopyPersistentVolumeClaim(from, to *corev1.PersistentVolumeClaim, log logr.Logger) bool {
-	requireUpdate := false
-	for k, v := range to.Labels {
-		if from.Labels[k] != v {
-			log.V(1).Info("reconciling PersistentVolumeClaim due to label change")
-			log.V(2).Info("difference in PersistentVolumeClaim labels", "wanted", from.Labels, "existing", to.Labels)
-			requireUpdate = true
+// allowsVolumeExpansion returns true if the StorageClass className sets allowVolumeExpansion.
+// Claims without a StorageClass, or whose StorageClass no longer exists, can't be expanded.
+func allowsVolumeExpansion(ctx context.Context, r client.Client, className *string) (bool, error) {
+	if className == nil || *className == "" {
+		return false, nil
+	}
+	class := &storagev1.StorageClass{}
+	if err := r.Get(ctx, client.ObjectKey{Name: *className}, class); err != nil {
+		if apierrs.IsNotFound(err) {
+			return false, nil
 		}
+		return false, errors.Wrapf(err, "unable to get StorageClass %s", *className)
 	}
-	if len(to.Labels) == 0 && len(from.Labels) != 0 {
-		log.V(1).Info("reconciling PersistentVolumeClaim due to label change")
-		log.V(2).Info("difference in PersistentVolumeClaim labels", "wanted", from.Labels, "existing", to.Labels)
-		requireUpdate = true
+	return class.AllowVolumeExpansion != nil && *class.AllowVolumeExpansion, nil
+}
+
+// resizeProgress returns the resize status of pvc from its status, requested is the desired storage request.
+func resizeProgress(pvc *corev1.PersistentVolumeClaim, requested resource.Quantity) ResizeStatus {
+	status := ResizeStatus{State: ResizeStateNone, Requested: requested, Capacity: pvc.Status.Capacity[corev1.ResourceStorage]}
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case corev1.PersistentVolumeClaimFileSystemResizePending:
+			status.State = ResizeStateFileSystemResizePending
+			status.Message = "waiting for a pod to use the claim to resize its file system"
+			if condition.Message != "" {
+				status.Message = condition.Message
+			}
+			return status
+		case corev1.PersistentVolumeClaimResizing:
+			status.State = ResizeStateInProgress
+			status.Message = "volume is being expanded to " + requested.String()
+			if condition.Message != "" {
+				status.Message = condition.Message
+			}
+		}
 	}
-	to.Labels = from.Labels
-
-	// for k, v := range to.Annotations {
-	// 	if from.Annotations[k] != v {
-	// 		log.V(1).Info("reconciling PersistentVolumeClaim due to annotation change")
-	// 		log.V(2).Info("difference in PersistentVolumeClaim annotations", "wanted", from.Annotations, "existing", to.Annotations)
-	// 		requireUpdate = true
-	// 	}
-	// }
-	// if len(to.Annotations) == 0 && len(from.Annotations) != 0 {
-	// 	log.V(1).Info("reconciling PersistentVolumeClaim due to annotation change")
-	// 	log.V(2).Info("difference in PersistentVolumeClaim annotations", "wanted", from.Annotations, "existing", to.Annotations)
-	// 	requireUpdate = true
-	// }
-	// to.Annotations = from.Annotations
-
-	if !reflect.DeepEqual(to.Spec.Resources.Requests, from.Spec.Resources.Requests) {
-		log.V(1).Info("reconciling PersistentVolumeClaim due to resource requests change")
-		log.V(2).Info("difference in PersistentVolumeClaim resource requests", "wanted", from.Spec.Resources.Requests, "existing", to.Spec.Resources.Requests)
-		requireUpdate = true
+	if status.State == ResizeStateNone && pvc.Status.Phase == corev1.ClaimBound && !status.Capacity.IsZero() && requested.Cmp(status.Capacity) > 0 {
+		status.State = ResizeStateInProgress
+		status.Message = "volume is being expanded from " + status.Capacity.String() + " to " + requested.String()
 	}
-	to.Spec.Resources.Requests = from.Spec.Resources.Requests
+	return status
+}
+
+// CopyPersistentVolumeClaim copies the owned fields from one PersistentVolumeClaim to another
+// Returns true if the fields copied from don't match to.
+func CopyPersistentVolumeClaim(from, to *corev1.PersistentVolumeClaim, log logr.Logger) bool {
+	from = from.DeepCopy()
+	defaultPersistentVolumeClaimSpec(&from.Spec)
+
+	requireUpdate := false
+	requireUpdate = copyField(log, "PersistentVolumeClaim", "metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyAnnotations(log, "PersistentVolumeClaim", &to.Annotations, from.Annotations) || requireUpdate
+
+	requireUpdate = copyField(log, "PersistentVolumeClaim", "spec.resources.requests", &to.Spec.Resources.Requests, from.Spec.Resources.Requests) || requireUpdate
 
 	return requireUpdate
 }
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reconcile makes sure the object described by desired exists in the cluster.
+// If the object does not exist yet it is created, otherwise copyFn is called to
+// copy the owned fields from desired onto the live object; when copyFn reports a
+// difference the live object is updated. When WithServerSideApply is given the
+// desired object is applied instead, see apply. If desired changes an immutable
+// field of the live object an error is returned, or the live object is deleted to be
+// recreated if WithRecreateOnImmutableChange is given.
+//
+// All kind specific helpers in this package delegate to Reconcile, so adding
+// support for a new kind only requires writing its copy function.
+func Reconcile[T client.Object](ctx context.Context, r client.Client, desired T, copyFn func(from, to T) bool, opts ...Option) (Result, error) {
+	o := newOptions(opts...)
+	log := o.logger(ctx)
+	kind := kindOf(desired)
+	key := client.ObjectKeyFromObject(desired)
+
+	found := newObject(desired)
+	exists := true
+	if err := r.Get(ctx, key, found); err != nil {
+		if !apierrs.IsNotFound(err) {
+			log.Error(err, "Error getting "+kind)
+			return Result{}, errors.Wrapf(err, "unable to get %s %s", kind, key)
+		}
+		exists = false
+	}
+
+	if exists {
+		if err := o.checkManaged(found); err != nil {
+			log.Error(err, "Refusing to reconcile "+kind)
+			return Result{}, errors.Wrapf(err, "unable to reconcile %s %s", kind, key)
+		}
+		if err := o.checkOwner(found); err != nil {
+			log.Error(err, "Refusing to reconcile "+kind)
+			return Result{}, errors.Wrapf(err, "unable to reconcile %s %s", kind, key)
+		}
+	}
+
+	var live client.Object
+	if exists {
+		live = found
+	}
+	for _, prepare := range o.prepare {
+		if err := prepare(ctx, r, desired, live); err != nil {
+			log.Error(err, "Unable to prepare "+kind)
+			return Result{}, errors.Wrapf(err, "unable to reconcile %s %s", kind, key)
+		}
+	}
+	if exists {
+		if changes := o.checkImmutable(desired, found).Redact(redactedPaths[kind]...); len(changes) != 0 {
+			if !o.recreate {
+				err := immutableError(changes)
+				log.Error(err, "Refusing to reconcile "+kind)
+				return Result{}, errors.Wrapf(err, "unable to reconcile %s %s", kind, key)
+			}
+			return recreate(ctx, r, desired, found, changes, o)
+		}
+	}
+	o.setManagedBy(desired)
+
+	if o.fieldManager != "" {
+		return apply(ctx, r, desired, found, exists, o)
+	}
+
+	if !exists {
+		if err := o.setOwner(desired); err != nil {
+			return Result{}, errors.Wrapf(err, "unable to set owner of %s %s", kind, key)
+		}
+		log.Info("Creating "+kind, keysAndValues(desired)...)
+		if err := r.Create(ctx, desired, o.createOptions()...); err != nil {
+			log.Error(err, "Unable to create "+kind)
+			return Result{}, errors.Wrapf(err, "unable to create %s %s", kind, key)
+		}
+		return o.planned(Result{Operation: OperationResultCreated, Object: desired}, nil)
+	}
+
+	before := found.DeepCopyObject().(client.Object)
+	requireUpdate := copyFn(desired, found)
+	if err := o.setOwner(found); err != nil {
+		return Result{}, errors.Wrapf(err, "unable to set owner of %s %s", kind, key)
+	}
+	changes := Diff("", before, found).Redact(redactedPaths[kind]...)
+	if !requireUpdate && len(changes) == 0 {
+		return o.planned(Result{Operation: OperationResultUnchanged, Object: found}, before)
+	}
+
+	log.Info("Updating "+kind, append(keysAndValues(desired), "changes", changes.Strings())...)
+	if err := r.Update(ctx, found, o.updateOptions()...); err != nil {
+		log.Error(err, "Unable to update "+kind)
+		return Result{}, errors.Wrapf(err, "unable to update %s %s", kind, key)
+	}
+	return o.planned(Result{Operation: OperationResultUpdated, Changes: changes, Object: found}, before)
+}
+
+// kindOf returns the name of the Go type backing obj, e.g. "Deployment".
+func kindOf(obj client.Object) string {
+	return reflect.TypeOf(obj).Elem().Name()
+}
+
+// newObject returns a new, empty object of the same type as obj.
+func newObject[T client.Object](obj T) T {
+	return reflect.New(reflect.TypeOf(obj).Elem()).Interface().(T)
+}
+
+// keysAndValues returns the logging key/value pairs identifying obj.
+func keysAndValues(obj client.Object) []interface{} {
+	if obj.GetNamespace() == "" {
+		return []interface{}{"name", obj.GetName()}
+	}
+	return []interface{}{"namespace", obj.GetNamespace(), "name", obj.GetName()}
+}
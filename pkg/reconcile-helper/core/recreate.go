@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrImmutableFieldChanged is returned when the desired object changes a field of the
+// live object that cannot be updated and WithRecreateOnImmutableChange is not set.
+var ErrImmutableFieldChanged = errors.New("immutable field changed")
+
+// RecreateRequeueAfter is the delay after which a caller should reconcile again
+// to create an object that was deleted because an immutable field changed.
+var RecreateRequeueAfter = 5 * time.Second
+
+// immutableFn returns the changes desired makes to the immutable fields of found.
+type immutableFn func(desired, found client.Object) Changes
+
+// withImmutableFields sets the function that detects changes to immutable fields.
+// It is set by the kind specific helpers whose kind has such fields.
+func withImmutableFields(fn immutableFn) Option {
+	return func(o *options) {
+		o.immutable = fn
+	}
+}
+
+// beforeRecreateFn is called with the desired and the live object before the live object is deleted to be recreated.
+type beforeRecreateFn func(ctx context.Context, r client.Client, desired, found client.Object, o *options) error
+
+// withBeforeRecreate sets the function that prepares the recreation of an object,
+// e.g. by migrating dependents that are orphaned when the live object is deleted.
+func withBeforeRecreate(fn beforeRecreateFn) Option {
+	return func(o *options) {
+		o.beforeRecreate = fn
+	}
+}
+
+// withRecreateNow makes recreate create the desired object right after deleting the live one,
+// instead of leaving that to the next reconcile call. It is set by the kind specific helpers
+// whose objects must not be missing, e.g. Secrets mounted by running pods.
+func withRecreateNow() Option {
+	return func(o *options) {
+		o.recreateNow = true
+	}
+}
+
+// checkImmutable returns the changes desired makes to the immutable fields of found.
+func (o *options) checkImmutable(desired, found client.Object) Changes {
+	if o.immutable == nil {
+		return nil
+	}
+	return o.immutable(desired, found)
+}
+
+// recreate deletes found so that it can be created again from the desired object on the
+// next reconcile call, or right away if withRecreateNow is set. Dependents, e.g. the pods of
+// a Deployment or the pods and volumes of a StatefulSet, are orphaned so that they keep
+// running until the new object adopts them. If the selector changed the new object would
+// never adopt them, so they are deleted in the background together with found instead.
+func recreate(ctx context.Context, r client.Client, desired, found client.Object, changes Changes, o *options) (Result, error) {
+	log := o.logger(ctx)
+	kind := kindOf(found)
+	key := client.ObjectKeyFromObject(found)
+
+	result := Result{Operation: OperationResultDeleted, Changes: changes, Object: found, RequeueAfter: RecreateRequeueAfter}
+	if found.GetDeletionTimestamp() != nil {
+		log.Info("Waiting for "+kind+" to be deleted", keysAndValues(found)...)
+		result.Operation = OperationResultUnchanged
+		result.Changes = nil
+		return o.planned(result, found)
+	}
+
+	if o.beforeRecreate != nil {
+		if err := o.beforeRecreate(ctx, r, desired, found, o); err != nil {
+			log.Error(err, "Unable to prepare recreating "+kind)
+			return Result{}, errors.Wrapf(err, "unable to recreate %s %s", kind, key)
+		}
+	}
+
+	propagation := metav1.DeletePropagationOrphan
+	if len(changes) != len(changes.Without("spec.selector")) {
+		propagation = metav1.DeletePropagationBackground
+	}
+	log.Info("Recreating "+kind+" due to immutable field change", append(keysAndValues(found), "changes", changes.Strings(), "propagation", propagation)...)
+	if err := r.Delete(ctx, found, o.deleteOptions(propagation)...); err != nil {
+		log.Error(err, "Unable to delete "+kind)
+		return Result{}, errors.Wrapf(err, "unable to delete %s %s", kind, key)
+	}
+	if !o.recreateNow {
+		return o.planned(result, found)
+	}
+
+	o.setManagedBy(desired)
+	if err := o.setOwner(desired); err != nil {
+		return Result{}, errors.Wrapf(err, "unable to set owner of %s %s", kind, key)
+	}
+	created := Result{Operation: OperationResultCreated, Changes: changes, Object: desired}
+	if o.dryRun {
+		// The live object was not deleted, so creating desired would fail.
+		return o.planned(created, found)
+	}
+	desired.SetResourceVersion("")
+	if err := r.Create(ctx, desired, o.createOptions()...); err != nil {
+		if apierrs.IsAlreadyExists(err) {
+			// The live object is still being deleted, e.g. because of a finalizer.
+			log.Info("Waiting for "+kind+" to be deleted", keysAndValues(found)...)
+			return o.planned(result, found)
+		}
+		log.Error(err, "Unable to create "+kind)
+		return Result{}, errors.Wrapf(err, "unable to create %s %s", kind, key)
+	}
+	return o.planned(created, found)
+}
+
+// immutableError returns an error wrapping ErrImmutableFieldChanged listing the changed fields.
+func immutableError(changes Changes) error {
+	return errors.Wrapf(ErrImmutableFieldChanged, "%s, see WithRecreateOnImmutableChange", strings.Join(changes.Paths(), ", "))
+}
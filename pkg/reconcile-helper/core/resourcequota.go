@@ -0,0 +1,31 @@
+package core
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResourceQuota reconciles a ResourceQuota object.
+func ResourceQuota(ctx context.Context, r client.Client, resourceQuota *corev1.ResourceQuota, log logr.Logger, opts ...Option) (Result, error) {
+	return Reconcile(ctx, r, resourceQuota, func(from, to *corev1.ResourceQuota) bool {
+		return CopyResourceQuota(from, to, log)
+	}, append([]Option{WithLogger(log)}, opts...)...)
+}
+
+// CopyResourceQuota copies the owned fields from one ResourceQuota to another
+// Returns true if the fields copied from don't match to.
+func CopyResourceQuota(from, to *corev1.ResourceQuota, log logr.Logger) bool {
+	requireUpdate := false
+	requireUpdate = copyField(log, "ResourceQuota", "metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyAnnotations(log, "ResourceQuota", &to.Annotations, from.Annotations) || requireUpdate
+
+	requireUpdate = copyField(log, "ResourceQuota", "spec.hard", &to.Spec.Hard, from.Spec.Hard) || requireUpdate
+	requireUpdate = copyField(log, "ResourceQuota", "spec.scopes", &to.Spec.Scopes, from.Spec.Scopes) || requireUpdate
+	requireUpdate = copyField(log, "ResourceQuota", "spec.scopeSelector", &to.Spec.ScopeSelector, from.Spec.ScopeSelector) || requireUpdate
+
+	return requireUpdate
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OperationResult is the action that was taken on an object by a reconcile call.
+type OperationResult string
+
+const (
+	// OperationResultUnchanged means the live object already matched the desired state.
+	OperationResultUnchanged OperationResult = "unchanged"
+	// OperationResultCreated means the object did not exist and was created.
+	OperationResultCreated OperationResult = "created"
+	// OperationResultUpdated means the live object was updated.
+	OperationResultUpdated OperationResult = "updated"
+	// OperationResultDeleted means the live object was deleted.
+	OperationResultDeleted OperationResult = "deleted"
+)
+
+// Result describes what a reconcile call did to an object.
+type Result struct {
+	// Operation is the action that was taken.
+	Operation OperationResult
+
+	// Changes lists the field level changes that were made to the live object by an update,
+	// e.g. "spec.template.spec.containers[name=app].image: a -> b". Secret values are redacted.
+	Changes Changes
+
+	// Object is the object as it is stored in the cluster after the reconcile call.
+	// For dry-run calls it is the object as it would have been stored.
+	Object client.Object
+
+	// DryRun is true if the operation was only simulated by the API server, see WithDryRun.
+	DryRun bool
+
+	// RequeueAfter is set when the caller should reconcile again after the given
+	// duration, e.g. to create an object that was deleted to be recreated.
+	RequeueAfter time.Duration
+
+	// Patch is the JSON patch (RFC 6902) that turns the live object into Object.
+	// It is only set for dry-run calls. Secret values are redacted, so the patch lists which
+	// keys change but can't be applied as is.
+	Patch []byte
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/pluralsh/controller-reconcile-helper/pkg/conditions"
+	crhelpertypes "github.com/pluralsh/controller-reconcile-helper/pkg/types"
+)
+
+// RolloutState is the state of the rollout of a Deployment or StatefulSet.
+type RolloutState string
+
+const (
+	// RolloutStateProgressing means the latest spec is still being rolled out.
+	RolloutStateProgressing RolloutState = "Progressing"
+	// RolloutStateAvailable means all replicas run the latest spec and are available.
+	RolloutStateAvailable RolloutState = "Available"
+	// RolloutStateFailed means the rollout stopped making progress.
+	RolloutStateFailed RolloutState = "Failed"
+)
+
+const (
+	// RolloutReasonWaitingForObservation means the controller has not observed the latest spec yet.
+	RolloutReasonWaitingForObservation = "WaitingForObservation"
+	// RolloutReasonUpdating means replicas are being updated to the latest spec.
+	RolloutReasonUpdating = "Updating"
+	// RolloutReasonTerminatingOldReplicas means old replicas are pending termination.
+	RolloutReasonTerminatingOldReplicas = "TerminatingOldReplicas"
+	// RolloutReasonWaitingForAvailability means updated replicas are not available yet.
+	RolloutReasonWaitingForAvailability = "WaitingForAvailability"
+	// RolloutReasonProgressDeadlineExceeded means a Deployment did not progress within its progress deadline.
+	RolloutReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+	// RolloutReasonReplicaFailure means a Deployment failed to create or delete replicas, e.g. due to a quota.
+	RolloutReasonReplicaFailure = "ReplicaFailure"
+)
+
+// RolloutStatus describes the rollout of a Deployment or StatefulSet.
+type RolloutStatus struct {
+	// State is the state of the rollout.
+	State RolloutState
+
+	// Reason is a CamelCase reason for the state, empty if the rollout is available.
+	Reason string
+
+	// Message is a human-readable description of the state.
+	Message string
+}
+
+// Condition returns a condition of type t reflecting the rollout status. It is true if the
+// rollout is available and false with Severity=Info while it is progressing or Severity=Error
+// if it failed.
+func (s RolloutStatus) Condition(t crhelpertypes.ConditionType) *crhelpertypes.Condition {
+	switch s.State {
+	case RolloutStateAvailable:
+		return conditions.TrueCondition(t)
+	case RolloutStateFailed:
+		return conditions.FalseCondition(t, s.Reason, crhelpertypes.ConditionSeverityError, "%s", s.Message)
+	default:
+		return conditions.FalseCondition(t, s.Reason, crhelpertypes.ConditionSeverityInfo, "%s", s.Message)
+	}
+}
+
+// DeploymentRolloutStatus returns the rollout status of a live Deployment, e.g. Result.Object
+// as returned by Deployment. It follows the checks of kubectl rollout status.
+func DeploymentRolloutStatus(deployment *appsv1.Deployment) RolloutStatus {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return progressing(RolloutReasonWaitingForObservation, "waiting for deployment spec update to be observed")
+	}
+	for _, condition := range deployment.Status.Conditions {
+		switch {
+		case condition.Type == appsv1.DeploymentProgressing && condition.Reason == RolloutReasonProgressDeadlineExceeded:
+			return RolloutStatus{State: RolloutStateFailed, Reason: RolloutReasonProgressDeadlineExceeded, Message: condition.Message}
+		case condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue:
+			return RolloutStatus{State: RolloutStateFailed, Reason: RolloutReasonReplicaFailure, Message: condition.Message}
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	switch {
+	case status.UpdatedReplicas < replicas:
+		return progressing(RolloutReasonUpdating, fmt.Sprintf("%d of %d replicas have been updated", status.UpdatedReplicas, replicas))
+	case status.Replicas > status.UpdatedReplicas:
+		return progressing(RolloutReasonTerminatingOldReplicas, fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas))
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return progressing(RolloutReasonWaitingForAvailability, fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas))
+	}
+	return RolloutStatus{State: RolloutStateAvailable, Message: fmt.Sprintf("%d of %d replicas are available", status.AvailableReplicas, replicas)}
+}
+
+// StatefulSetRolloutStatus returns the rollout status of a live StatefulSet, e.g. Result.Object
+// as returned by StatefulSet. It follows the checks of kubectl rollout status. As StatefulSets
+// have no progress deadline their rollout never fails, and with the OnDelete update strategy
+// only the readiness of the replicas is checked.
+func StatefulSetRolloutStatus(statefulset *appsv1.StatefulSet) RolloutStatus {
+	if statefulset.Status.ObservedGeneration == 0 || statefulset.Generation > statefulset.Status.ObservedGeneration {
+		return progressing(RolloutReasonWaitingForObservation, "waiting for statefulset spec update to be observed")
+	}
+
+	replicas := int32(1)
+	if statefulset.Spec.Replicas != nil {
+		replicas = *statefulset.Spec.Replicas
+	}
+	status := statefulset.Status
+	if status.ReadyReplicas < replicas || status.AvailableReplicas < replicas {
+		return progressing(RolloutReasonWaitingForAvailability, fmt.Sprintf("%d of %d replicas are available", status.AvailableReplicas, replicas))
+	}
+
+	strategy := statefulset.Spec.UpdateStrategy
+	if strategy.Type == appsv1.RollingUpdateStatefulSetStrategyType {
+		if strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil && *strategy.RollingUpdate.Partition > 0 {
+			if status.UpdatedReplicas < replicas-*strategy.RollingUpdate.Partition {
+				return progressing(RolloutReasonUpdating, fmt.Sprintf("%d of %d replicas above partition %d are updated", status.UpdatedReplicas, replicas-*strategy.RollingUpdate.Partition, *strategy.RollingUpdate.Partition))
+			}
+		} else if status.UpdateRevision != status.CurrentRevision {
+			return progressing(RolloutReasonUpdating, fmt.Sprintf("%d of %d replicas are updated to revision %s", status.UpdatedReplicas, replicas, status.UpdateRevision))
+		}
+	}
+	return RolloutStatus{State: RolloutStateAvailable, Message: fmt.Sprintf("%d of %d replicas are available", status.AvailableReplicas, replicas)}
+}
+
+func progressing(reason, message string) RolloutStatus {
+	return RolloutStatus{State: RolloutStateProgressing, Reason: reason, Message: message}
+}
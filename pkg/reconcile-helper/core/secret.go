@@ -2,84 +2,116 @@ package core
 
 import (
 	"context"
-	"reflect"
 
 	"github.com/go-logr/logr"
 
 	corev1 "k8s.io/api/core/v1"
-	apierrs "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// Secret reconciles a k8s secret object.
-func Secret(ctx context.Context, r client.Client, secret *corev1.Secret, log logr.Logger) error {
-	foundSecret := &corev1.Secret{}
-	justCreated := false
-	if err := r.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, foundSecret); err != nil {
-		if apierrs.IsNotFound(err) {
-			log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
-			if err := r.Create(ctx, secret); err != nil {
-				log.Error(err, "Unable to create Secret")
-				return err
+// Secret reconciles a k8s secret object. As the type of a secret, and the data of an
+// immutable secret, can't be changed, changing them requires WithRecreateOnImmutableChange,
+// which recreates the secret within the same call so pods mounting it don't miss it.
+// A secret without a type keeps the type of the live secret.
+func Secret(ctx context.Context, r client.Client, secret *corev1.Secret, log logr.Logger, opts ...Option) (Result, error) {
+	return Reconcile(ctx, r, secret, func(from, to *corev1.Secret) bool {
+		return CopySecretFields(from, to, log)
+	}, append([]Option{WithLogger(log), withImmutableFields(secretImmutableChanges), withRecreateNow(), withPrepare(keepSecretType)}, opts...)...)
+}
+
+// keepSecretType sets the type of the live secret found on desired if desired has none,
+// so that a recreated secret keeps it as well.
+func keepSecretType(ctx context.Context, r client.Client, desired, found client.Object) error {
+	if secret := desired.(*corev1.Secret); secret.Type == "" && found != nil {
+		secret.Type = found.(*corev1.Secret).Type
+	}
+	return nil
+}
+
+// WithCreateOnlyKeys makes the given data keys of a Secret create-only: their desired value is
+// only used when the key is missing from the live Secret and never overwrites an existing value.
+// This allows generating e.g. a password on every reconcile without ever rotating it.
+// It has no effect on other kinds.
+func WithCreateOnlyKeys(keys ...string) Option {
+	return withPrepare(func(ctx context.Context, r client.Client, desired, found client.Object) error {
+		secret, ok := desired.(*corev1.Secret)
+		if !ok || found == nil {
+			return nil
+		}
+		live := found.(*corev1.Secret)
+
+		normalizeSecret(secret)
+		for _, key := range keys {
+			value, exists := live.Data[key]
+			if !exists {
+				continue
+			}
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
 			}
-			justCreated = true
-		} else {
-			log.Error(err, "Error getting Secret")
-			return err
+			secret.Data[key] = value
 		}
+		return nil
+	})
+}
+
+// secretImmutableChanges returns the changes desired makes to the type of found, if desired
+// sets one, and to the data of found if it is immutable.
+func secretImmutableChanges(desired, found client.Object) Changes {
+	from, to := desired.(*corev1.Secret).DeepCopy(), found.(*corev1.Secret)
+	normalizeSecret(from)
+
+	var changes Changes
+	if from.Type != "" {
+		changes = Diff("type", to.Type, from.Type)
 	}
-	if !justCreated && CopySecretFields(secret, foundSecret, log) {
-		log.Info("Updating Secret", "namespace", secret.Namespace, "name", secret.Name)
-		if err := r.Update(ctx, foundSecret); err != nil {
-			log.Error(err, "Unable to update Secret")
-			return err
+	if to.Immutable != nil && *to.Immutable {
+		if from.Immutable == nil || !*from.Immutable {
+			changes = append(changes, Diff("immutable", to.Immutable, from.Immutable)...)
+		}
+		if to.Type != corev1.SecretTypeServiceAccountToken {
+			changes = append(changes, Diff("data", to.Data, from.Data)...)
 		}
 	}
+	return changes
+}
 
-	return nil
+// normalizeSecret merges the string data of secret into its data, as the API server does.
+func normalizeSecret(secret *corev1.Secret) {
+	if len(secret.StringData) == 0 {
+		return
+	}
+	data := make(map[string][]byte, len(secret.Data)+len(secret.StringData))
+	for key, value := range secret.Data {
+		data[key] = value
+	}
+	for key, value := range secret.StringData {
+		data[key] = []byte(value)
+	}
+	secret.Data = data
+	secret.StringData = nil
 }
 
 // CopySecretFields copies the owned fields from one Service to another
 // Returns true if the fields copied from don't match to.
 func CopySecretFields(from, to *corev1.Secret, log logr.Logger) bool {
+	from = from.DeepCopy()
+	normalizeSecret(from)
+
 	requireUpdate := false
-	for k, v := range to.Labels {
-		if from.Labels[k] != v {
-			log.V(1).Info("reconciling secret due to label change")
-			log.V(2).Info("difference in secret labels", "wanted", from.Labels, "existing", to.Labels)
-			requireUpdate = true
-		}
-	}
-	if len(to.Labels) == 0 && len(from.Labels) != 0 {
-		log.V(1).Info("reconciling secret due to label change")
-		log.V(2).Info("difference in secret labels", "wanted", from.Labels, "existing", to.Labels)
-		requireUpdate = true
-	}
-	to.Labels = from.Labels
+	requireUpdate = copyField(log, "Secret", "metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyAnnotations(log, "Secret", &to.Annotations, from.Annotations) || requireUpdate
 
-	for k, v := range to.Annotations {
-		if from.Annotations[k] != v {
-			log.V(1).Info("reconciling secret due to annotation change")
-			log.V(2).Info("difference in secret annotations", "wanted", from.Annotations, "existing", to.Annotations)
-			requireUpdate = true
-		}
+	// The API server defaults a missing type to Opaque on creation, after that it can't be changed.
+	if from.Type != "" {
+		requireUpdate = copyField(log, "Secret", "type", &to.Type, from.Type) || requireUpdate
 	}
-	if len(to.Annotations) == 0 && len(from.Annotations) != 0 {
-		log.V(1).Info("reconciling secret due to annotation change")
-		log.V(2).Info("difference in secret annotations", "wanted", from.Annotations, "existing", to.Annotations)
-		requireUpdate = true
+	if from.Immutable != nil && *from.Immutable {
+		requireUpdate = copyField(log, "Secret", "immutable", &to.Immutable, from.Immutable) || requireUpdate
 	}
-	to.Annotations = from.Annotations
 
 	if to.Type != corev1.SecretTypeServiceAccountToken {
-		// Don't copy the entire Spec, because we can't overwrite the clusterIp field
-		if !reflect.DeepEqual(to.Data, from.Data) {
-			log.V(1).Info("reconciling secret due to data change")
-			log.V(2).Info("difference in secret selector", "wanted", from.Data, "existing", to.Data)
-			requireUpdate = true
-		}
-		to.Data = from.Data
+		requireUpdate = copyField(log, "Secret", "data", &to.Data, from.Data) || requireUpdate
 	}
 
 	return requireUpdate
@@ -2,134 +2,133 @@ package core
 
 import (
 	"context"
-	"reflect"
+	"fmt"
 
 	"github.com/go-logr/logr"
 
 	corev1 "k8s.io/api/core/v1"
-	apierrs "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// Service reconciles a k8s service object.
-func Service(ctx context.Context, r client.Client, service *corev1.Service, log logr.Logger) error {
-	foundService := &corev1.Service{}
-	justCreated := false
-	if err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, foundService); err != nil {
-		if apierrs.IsNotFound(err) {
-			log.Info("Creating Service", "namespace", service.Namespace, "name", service.Name)
-			if err = r.Create(ctx, service); err != nil {
-				log.Error(err, "Unable to create Service")
-				return err
-			}
-			justCreated = true
-		} else {
-			log.Error(err, "Error getting Service")
-			return err
-		}
-	}
-	if !justCreated && CopyServiceFields(service, foundService, log) {
-		log.Info("Updating Service", "namespace", service.Namespace, "name", service.Name)
-		if err := r.Update(ctx, foundService); err != nil {
-			log.Error(err, "Unable to update Service")
-			return err
-		}
-	}
+// Service reconciles a k8s service object. As the cluster IP of a service is immutable,
+// changing it requires WithRecreateOnImmutableChange.
+func Service(ctx context.Context, r client.Client, service *corev1.Service, log logr.Logger, opts ...Option) (Result, error) {
+	return Reconcile(ctx, r, service, func(from, to *corev1.Service) bool {
+		return CopyServiceFields(from, to, log)
+	}, append([]Option{WithLogger(log), withImmutableFields(serviceImmutableChanges)}, opts...)...)
+}
 
-	return nil
+// serviceImmutableChanges returns the changes desired makes to the immutable cluster IP of found.
+// An empty desired cluster IP keeps the one allocated by the API server.
+func serviceImmutableChanges(desired, found client.Object) Changes {
+	from, to := desired.(*corev1.Service), found.(*corev1.Service)
+	if from.Spec.ClusterIP == "" || to.Spec.ClusterIP == "" {
+		return nil
+	}
+	return Diff("spec.clusterIP", to.Spec.ClusterIP, from.Spec.ClusterIP)
 }
 
 // CopyServiceFields copies the owned fields from one Service to another
 // Returns true if the fields copied from don't match to.
 func CopyServiceFields(from, to *corev1.Service, log logr.Logger) bool {
+	from = from.DeepCopy()
+	defaultService(from)
+
 	requireUpdate := false
-	for k, v := range to.Labels {
-		if from.Labels[k] != v {
-			log.V(1).Info("reconciling service due to label change")
-			log.V(2).Info("difference in service labels", "wanted", from.Labels, "existing", to.Labels)
-			requireUpdate = true
-		}
-	}
-	if len(to.Labels) == 0 && len(from.Labels) != 0 {
-		log.V(1).Info("reconciling service due to label change")
-		log.V(2).Info("difference in service labels", "wanted", from.Labels, "existing", to.Labels)
-		requireUpdate = true
-	}
-	to.Labels = from.Labels
+	requireUpdate = copyField(log, "Service", "metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyAnnotations(log, "Service", &to.Annotations, from.Annotations) || requireUpdate
 
-	for k, v := range to.Annotations {
-		if from.Annotations[k] != v {
-			log.V(1).Info("reconciling service due to annotation change")
-			log.V(2).Info("difference in service annotations", "wanted", from.Annotations, "existing", to.Annotations)
-			requireUpdate = true
-		}
+	// Don't copy the entire Spec, because we can't overwrite the clusterIp field
+	requireUpdate = copyField(log, "Service", "spec.selector", &to.Spec.Selector, from.Spec.Selector) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.type", &to.Spec.Type, from.Spec.Type) || requireUpdate
+
+	requireUpdate = copyField(log, "Service", "spec.externalName", &to.Spec.ExternalName, from.Spec.ExternalName) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.externalTrafficPolicy", &to.Spec.ExternalTrafficPolicy, from.Spec.ExternalTrafficPolicy) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.internalTrafficPolicy", &to.Spec.InternalTrafficPolicy, from.Spec.InternalTrafficPolicy) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.sessionAffinity", &to.Spec.SessionAffinity, from.Spec.SessionAffinity) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.sessionAffinityConfig", &to.Spec.SessionAffinityConfig, from.Spec.SessionAffinityConfig) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.publishNotReadyAddresses", &to.Spec.PublishNotReadyAddresses, from.Spec.PublishNotReadyAddresses) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.loadBalancerClass", &to.Spec.LoadBalancerClass, from.Spec.LoadBalancerClass) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.loadBalancerSourceRanges", &to.Spec.LoadBalancerSourceRanges, from.Spec.LoadBalancerSourceRanges) || requireUpdate
+	requireUpdate = copyField(log, "Service", "spec.allocateLoadBalancerNodePorts", &to.Spec.AllocateLoadBalancerNodePorts, from.Spec.AllocateLoadBalancerNodePorts) || requireUpdate
+
+	// IP families are chosen by the API server based on the cluster configuration unless they are set explicitly.
+	if from.Spec.IPFamilyPolicy != nil {
+		requireUpdate = copyField(log, "Service", "spec.ipFamilyPolicy", &to.Spec.IPFamilyPolicy, from.Spec.IPFamilyPolicy) || requireUpdate
 	}
-	if len(to.Annotations) == 0 && len(from.Annotations) != 0 {
-		log.V(1).Info("reconciling service due to annotation change")
-		log.V(2).Info("difference in service annotations", "wanted", from.Annotations, "existing", to.Annotations)
-		requireUpdate = true
+	if len(from.Spec.IPFamilies) != 0 {
+		requireUpdate = copyField(log, "Service", "spec.ipFamilies", &to.Spec.IPFamilies, from.Spec.IPFamilies) || requireUpdate
 	}
-	to.Annotations = from.Annotations
 
-	// Don't copy the entire Spec, because we can't overwrite the clusterIp field
-	if !reflect.DeepEqual(to.Spec.Selector, from.Spec.Selector) {
-		log.V(1).Info("reconciling service due to selector change")
-		log.V(2).Info("difference in service selector", "wanted", from.Spec.Selector, "existing", to.Spec.Selector)
-		requireUpdate = true
-	}
-	to.Spec.Selector = from.Spec.Selector
+	requireUpdate = copyServicePorts(log, "spec.ports", from.Spec.Ports, &to.Spec.Ports, usesNodePorts(&to.Spec)) || requireUpdate
 
-	if !reflect.DeepEqual(to.Spec.Type, from.Spec.Type) {
-		log.V(1).Info("reconciling service due to ports change")
-		log.V(2).Info("difference in service type", "wanted", from.Spec.Type, "existing", to.Spec.Type)
-		requireUpdate = true
+	// Clear the fields allocated by the API server that are invalid for the reconciled type.
+	if to.Spec.Type == corev1.ServiceTypeExternalName {
+		requireUpdate = copyField(log, "Service", "spec.clusterIP", &to.Spec.ClusterIP, "") || requireUpdate
+		requireUpdate = copyField(log, "Service", "spec.clusterIPs", &to.Spec.ClusterIPs, nil) || requireUpdate
+		requireUpdate = copyField(log, "Service", "spec.ipFamilyPolicy", &to.Spec.IPFamilyPolicy, nil) || requireUpdate
+		requireUpdate = copyField(log, "Service", "spec.ipFamilies", &to.Spec.IPFamilies, nil) || requireUpdate
 	}
-	to.Spec.Type = from.Spec.Type
-
-	if to.Spec.Type == corev1.ServiceTypeLoadBalancer {
+	healthCheckNodePort := to.Spec.HealthCheckNodePort
+	if from.Spec.HealthCheckNodePort != 0 {
+		healthCheckNodePort = from.Spec.HealthCheckNodePort
+	}
+	if to.Spec.Type != corev1.ServiceTypeLoadBalancer || to.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyTypeLocal {
+		healthCheckNodePort = 0
+	}
+	requireUpdate = copyField(log, "Service", "spec.healthCheckNodePort", &to.Spec.HealthCheckNodePort, healthCheckNodePort) || requireUpdate
 
-		if !reflect.DeepEqual(to.Spec.Ports[0].AppProtocol, from.Spec.Ports[0].AppProtocol) {
-			log.V(1).Info("reconciling service due to ports change")
-			log.V(2).Info("difference in service ports", "wanted", from.Spec.Ports[0].AppProtocol, "existing", to.Spec.Ports[0].AppProtocol)
-			requireUpdate = true
-		}
-		to.Spec.Ports[0].AppProtocol = from.Spec.Ports[0].AppProtocol
+	return requireUpdate
+}
 
-		if !reflect.DeepEqual(to.Spec.Ports[0].Name, from.Spec.Ports[0].Name) {
-			log.V(1).Info("reconciling service due to ports change")
-			log.V(2).Info("difference in service ports", "wanted", from.Spec.Ports[0].Name, "existing", to.Spec.Ports[0].Name)
-			requireUpdate = true
-		}
-		to.Spec.Ports[0].Name = from.Spec.Ports[0].Name
+// copyServicePorts copies the ports of a Service, matching them by name or, for an unnamed
+// port, by port number and protocol. Node ports that are not set on the desired port keep the
+// value allocated by the API server as long as nodePorts is true, i.e. the Service type uses them.
+// Returns true if the ports copied from don't match to.
+func copyServicePorts(log logr.Logger, path string, from []corev1.ServicePort, to *[]corev1.ServicePort, nodePorts bool) bool {
+	wanted := make(map[string]corev1.ServicePort, len(from))
+	for _, port := range from {
+		wanted[servicePortKey(port)] = port
+	}
 
-		if !reflect.DeepEqual(to.Spec.Ports[0].Port, from.Spec.Ports[0].Port) {
-			log.V(1).Info("reconciling service due to ports change")
-			log.V(2).Info("difference in service ports", "wanted", from.Spec.Ports[0].Port, "existing", to.Spec.Ports[0].Port)
-			requireUpdate = true
+	// The order of ports has no meaning, so existing ports keep their position.
+	ports := make([]corev1.ServicePort, 0, len(from))
+	existing := make(map[string]bool, len(*to))
+	for _, live := range *to {
+		key := servicePortKey(live)
+		port, ok := wanted[key]
+		if !ok {
+			continue
 		}
-		to.Spec.Ports[0].Port = from.Spec.Ports[0].Port
-
-		if !reflect.DeepEqual(to.Spec.Ports[0].Protocol, from.Spec.Ports[0].Protocol) {
-			log.V(1).Info("reconciling service due to ports change")
-			log.V(2).Info("difference in service ports", "wanted", from.Spec.Ports[0].Protocol, "existing", to.Spec.Ports[0].Protocol)
-			requireUpdate = true
+		if port.NodePort == 0 && nodePorts {
+			port.NodePort = live.NodePort
 		}
-		if !reflect.DeepEqual(to.Spec.Ports[0].TargetPort, from.Spec.Ports[0].TargetPort) {
-			log.V(1).Info("reconciling service due to ports change")
-			log.V(2).Info("difference in service ports", "wanted", from.Spec.Ports[0].TargetPort, "existing", to.Spec.Ports[0].TargetPort)
-			requireUpdate = true
+		ports = append(ports, port)
+		existing[key] = true
+	}
+	for _, port := range from {
+		if !existing[servicePortKey(port)] {
+			ports = append(ports, port)
 		}
-		to.Spec.Ports[0].TargetPort = from.Spec.Ports[0].TargetPort
-	} else {
+	}
+	return copyField(log, "Service", path, to, ports)
+}
 
-		if !reflect.DeepEqual(to.Spec.Ports, from.Spec.Ports) {
-			log.V(1).Info("reconciling service due to ports change")
-			log.V(2).Info("difference in service ports", "wanted", from.Spec.Ports, "existing", to.Spec.Ports)
-			requireUpdate = true
-		}
-		to.Spec.Ports = from.Spec.Ports
+// servicePortKey returns the key a Service port is matched by.
+func servicePortKey(port corev1.ServicePort) string {
+	if port.Name != "" {
+		return port.Name
 	}
+	return fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+}
 
-	return requireUpdate
+// usesNodePorts returns true if node ports are allocated for the ports of a Service with spec.
+func usesNodePorts(spec *corev1.ServiceSpec) bool {
+	switch spec.Type {
+	case corev1.ServiceTypeNodePort:
+		return true
+	case corev1.ServiceTypeLoadBalancer:
+		return spec.AllocateLoadBalancerNodePorts == nil || *spec.AllocateLoadBalancerNodePorts
+	}
+	return false
 }
@@ -2,202 +2,167 @@ package core
 
 import (
 	"context"
-	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 
 	appsv1 "k8s.io/api/apps/v1"
-	apierrs "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// Statefulset reconciles a k8s statefulset object.
-func StatefulSet(ctx context.Context, r client.Client, statefulset *appsv1.StatefulSet, log logr.Logger) error {
-	foundStatefulset := &appsv1.StatefulSet{}
-	justCreated := false
-	if err := r.Get(ctx, types.NamespacedName{Name: statefulset.Name, Namespace: statefulset.Namespace}, foundStatefulset); err != nil {
-		if apierrs.IsNotFound(err) {
-			log.Info("Creating StatefulSet", "namespace", statefulset.Namespace, "name", statefulset.Name)
-			if err := r.Create(ctx, statefulset); err != nil {
-				log.Error(err, "Unable to create StatefulSet")
-				return err
-			}
-			justCreated = true
-		} else {
-			log.Error(err, "Error getting StatefulSet")
-			return err
-		}
-	}
-	if !justCreated && CopyStatefulSetFields(statefulset, foundStatefulset, log) {
-		log.Info("Updating StatefulSet", "namespace", statefulset.Namespace, "name", statefulset.Name)
-		if err := r.Update(ctx, foundStatefulset); err != nil {
-			log.Error(err, "Unable to update StatefulSet")
-			return err
-		}
-	}
-
-	return nil
+// StatefulSet reconciles a k8s statefulset object. As the volume claim templates, service name,
+// pod management policy and selector of a statefulset are immutable, changing them requires
+// WithRecreateOnImmutableChange, optionally combined with WithClaimExpansion.
+func StatefulSet(ctx context.Context, r client.Client, statefulset *appsv1.StatefulSet, log logr.Logger, opts ...Option) (Result, error) {
+	return Reconcile(ctx, r, statefulset, func(from, to *appsv1.StatefulSet) bool {
+		return CopyStatefulSetFields(from, to, log)
+	}, append([]Option{WithLogger(log), withImmutableFields(statefulSetImmutableChanges), withBeforeRecreate(expandStatefulSetClaims)}, opts...)...)
 }
 
-// CopyStatefulSetFields copies the owned fields from one StatefulSet to another
-// Returns true if the fields copied from don't match to.
-func CopyStatefulSetFields(from, to *appsv1.StatefulSet, log logr.Logger) bool {
-	requireUpdate := false
-	for k, v := range to.Labels {
-		if from.Labels[k] != v {
-			log.V(1).Info("reconciling StatefulSet due to label change")
-			log.V(2).Info("difference in StatefulSet labels", "wanted", from.Labels, "existing", to.Labels)
-			requireUpdate = true
-		}
-	}
-	if len(to.Labels) == 0 && len(from.Labels) != 0 {
-		log.V(1).Info("reconciling StatefulSet due to label change")
-		log.V(2).Info("difference in StatefulSet labels", "wanted", from.Labels, "existing", to.Labels)
-		requireUpdate = true
-	}
-	to.Labels = from.Labels
+// statefulSetImmutableChanges returns the changes desired makes to the immutable fields of found.
+func statefulSetImmutableChanges(desired, found client.Object) Changes {
+	from, to := desired.(*appsv1.StatefulSet).DeepCopy(), found.(*appsv1.StatefulSet)
+	defaultStatefulSet(from)
 
-	for k, v := range to.Annotations {
-		if from.Annotations[k] != v {
-			log.V(1).Info("reconciling StatefulSet due to annotation change")
-			log.V(2).Info("difference in StatefulSet annotations", "wanted", from.Annotations, "existing", to.Annotations)
-			requireUpdate = true
-		}
-	}
-	if len(to.Annotations) == 0 && len(from.Annotations) != 0 {
-		log.V(1).Info("reconciling StatefulSet due to annotation change")
-		log.V(2).Info("difference in StatefulSet annotations", "wanted", from.Annotations, "existing", to.Annotations)
-		requireUpdate = true
+	var changes Changes
+	changes = append(changes, Diff("spec.serviceName", to.Spec.ServiceName, from.Spec.ServiceName)...)
+	changes = append(changes, Diff("spec.podManagementPolicy", to.Spec.PodManagementPolicy, from.Spec.PodManagementPolicy)...)
+	if from.Spec.Selector != nil {
+		changes = append(changes, Diff("spec.selector", to.Spec.Selector, from.Spec.Selector)...)
 	}
-	to.Annotations = from.Annotations
+	changes = append(changes, Diff("spec.volumeClaimTemplates", claimTemplates(to.Spec.VolumeClaimTemplates), claimTemplates(from.Spec.VolumeClaimTemplates))...)
+	return changes
+}
 
-	if !reflect.DeepEqual(to.Spec.Replicas, from.Spec.Replicas) {
-		log.V(1).Info("reconciling StatefulSet due to replica change")
-		log.V(2).Info("difference in StatefulSet replicas", "wanted", from.Spec.Replicas, "existing", to.Spec.Replicas)
-		requireUpdate = true
-	}
-	to.Spec.Replicas = from.Spec.Replicas
+// claimTemplates returns the owned fields of volume claim templates, leaving out the
+// status and metadata set by the API server.
+func claimTemplates(templates []corev1.PersistentVolumeClaim) []corev1.PersistentVolumeClaim {
+	owned := make([]corev1.PersistentVolumeClaim, 0, len(templates))
+	for _, template := range templates {
+		owned = append(owned, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        template.Name,
+				Labels:      template.Labels,
+				Annotations: template.Annotations,
+			},
+			Spec: template.Spec,
+		})
+	}
+	return owned
+}
 
-	for k, v := range to.Spec.Template.Labels {
-		if from.Spec.Template.Labels[k] != v {
-			log.V(1).Info("reconciling StatefulSet due to template label change")
-			log.V(2).Info("difference in StatefulSet template labels", "wanted", from.Spec.Template.Labels, "existing", to.Spec.Template.Labels)
-			requireUpdate = true
+// ErrClaimExpansionNotAllowed is returned when a StatefulSet is to be recreated with
+// WithClaimExpansion, but the StorageClass of one of its PersistentVolumeClaims does
+// not allow expanding it to the storage requested by the new volume claim templates.
+var ErrClaimExpansionNotAllowed = errors.New("claim expansion not allowed")
+
+// expandStatefulSetClaims expands the PersistentVolumeClaims of the pods of found created from the
+// volume claim templates to the storage requested by the templates of desired if WithClaimExpansion
+// is set. Claims are never shrunk. If the StorageClass of a claim does not allow expanding it,
+// no claim is expanded and an error wrapping ErrClaimExpansionNotAllowed is returned, so that
+// the StatefulSet is not recreated with templates its claims don't match.
+func expandStatefulSetClaims(ctx context.Context, r client.Client, desired, found client.Object, o *options) error {
+	if !o.expandClaims {
+		return nil
+	}
+	log := o.logger(ctx)
+	statefulset, live := desired.(*appsv1.StatefulSet), found.(*appsv1.StatefulSet)
+
+	// The StatefulSet controller labels the claims it creates with the match labels of the selector.
+	claims := &corev1.PersistentVolumeClaimList{}
+	listOpts := []client.ListOption{client.InNamespace(live.Namespace)}
+	if live.Spec.Selector != nil {
+		listOpts = append(listOpts, client.MatchingLabels(live.Spec.Selector.MatchLabels))
+	}
+	if err := r.List(ctx, claims, listOpts...); err != nil {
+		return errors.Wrap(err, "unable to list PersistentVolumeClaims")
+	}
+
+	var expand []*corev1.PersistentVolumeClaim
+	var refused []string
+	for _, template := range statefulset.Spec.VolumeClaimTemplates {
+		wanted, ok := template.Spec.Resources.Requests[corev1.ResourceStorage]
+		if !ok {
+			continue
 		}
-	}
-	if len(to.Spec.Template.Labels) == 0 && len(from.Spec.Template.Labels) != 0 {
-		log.V(1).Info("reconciling StatefulSet due to template label change")
-		log.V(2).Info("difference in StatefulSet template labels", "wanted", from.Spec.Template.Labels, "existing", to.Spec.Template.Labels)
-		requireUpdate = true
-	}
-	to.Spec.Template.Labels = from.Spec.Template.Labels
+		for i := range claims.Items {
+			claim := &claims.Items[i]
+			if !isStatefulSetClaim(claim.Name, template.Name, live) {
+				continue
+			}
+			current := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+			if wanted.Cmp(current) <= 0 {
+				continue
+			}
+			allowed, err := allowsVolumeExpansion(ctx, r, claim.Spec.StorageClassName)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				log.Info("Not expanding PersistentVolumeClaim, its StorageClass does not allow volume expansion", "namespace", claim.Namespace, "name", claim.Name)
+				refused = append(refused, claim.Name)
+				continue
+			}
 
-	for k, v := range to.Spec.Template.Annotations {
-		if from.Spec.Template.Annotations[k] != v {
-			log.V(1).Info("reconciling StatefulSet due to template annotation change")
-			log.V(2).Info("difference in StatefulSet template annotations", "wanted", from.Spec.Template.Annotations, "existing", to.Spec.Template.Annotations)
-			requireUpdate = true
+			if claim.Spec.Resources.Requests == nil {
+				claim.Spec.Resources.Requests = corev1.ResourceList{}
+			}
+			claim.Spec.Resources.Requests[corev1.ResourceStorage] = wanted
+			expand = append(expand, claim)
 		}
 	}
-	if len(to.Spec.Template.Annotations) == 0 && len(from.Spec.Template.Annotations) != 0 {
-		log.V(1).Info("reconciling StatefulSet due to template annotation change")
-		log.V(2).Info("difference in StatefulSet template annotations", "wanted", from.Spec.Template.Annotations, "existing", to.Spec.Template.Annotations)
-		requireUpdate = true
-	}
-	to.Spec.Template.Annotations = from.Spec.Template.Annotations
-
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Volumes, from.Spec.Template.Spec.Volumes) {
-		log.V(1).Info("reconciling StatefulSet due to volumes change")
-		log.V(2).Info("difference in StatefulSet volumes", "wanted", from.Spec.Template.Spec.Volumes, "existing", to.Spec.Template.Spec.Volumes)
-		requireUpdate = true
+	if len(refused) != 0 {
+		return errors.Wrapf(ErrClaimExpansionNotAllowed, "StorageClass of PersistentVolumeClaims %s does not allow volume expansion", strings.Join(refused, ", "))
 	}
-	to.Spec.Template.Spec.Volumes = from.Spec.Template.Spec.Volumes
 
-	if !reflect.DeepEqual(to.Spec.Template.Spec.ServiceAccountName, from.Spec.Template.Spec.ServiceAccountName) {
-		log.V(1).Info("reconciling StatefulSet due to service account name change")
-		log.V(2).Info("difference in StatefulSet service account name", "wanted", from.Spec.Template.Spec.ServiceAccountName, "existing", to.Spec.Template.Spec.ServiceAccountName)
-		requireUpdate = true
-	}
-	to.Spec.Template.Spec.ServiceAccountName = from.Spec.Template.Spec.ServiceAccountName
-
-	if !reflect.DeepEqual(to.Spec.Template.Spec.SecurityContext, from.Spec.Template.Spec.SecurityContext) {
-		log.V(1).Info("reconciling StatefulSet due to security context change")
-		log.V(2).Info("difference in StatefulSet security context", "wanted", from.Spec.Template.Spec.SecurityContext, "existing", to.Spec.Template.Spec.SecurityContext)
-		requireUpdate = true
-	}
-	to.Spec.Template.Spec.SecurityContext = from.Spec.Template.Spec.SecurityContext
-
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Affinity, from.Spec.Template.Spec.Affinity) {
-		log.V(1).Info("reconciling StatefulSet due to affinity change")
-		log.V(2).Info("difference in StatefulSet affinity", "wanted", from.Spec.Template.Spec.Affinity, "existing", to.Spec.Template.Spec.Affinity)
-		requireUpdate = true
-	}
-	to.Spec.Template.Spec.Affinity = from.Spec.Template.Spec.Affinity
-
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Tolerations, from.Spec.Template.Spec.Tolerations) {
-		log.V(1).Info("reconciling StatefulSet due to toleration change")
-		log.V(2).Info("difference in StatefulSet tolerations", "wanted", from.Spec.Template.Spec.Tolerations, "existing", to.Spec.Template.Spec.Tolerations)
-		requireUpdate = true
+	for _, claim := range expand {
+		log.Info("Expanding PersistentVolumeClaim", "namespace", claim.Namespace, "name", claim.Name, "to", claim.Spec.Resources.Requests.Storage().String())
+		if err := r.Update(ctx, claim, o.updateOptions()...); err != nil {
+			return errors.Wrapf(err, "unable to expand PersistentVolumeClaim %s", client.ObjectKeyFromObject(claim))
+		}
 	}
-	to.Spec.Template.Spec.Tolerations = from.Spec.Template.Spec.Tolerations
+	return nil
+}
 
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].Name, from.Spec.Template.Spec.Containers[0].Name) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] name change")
-		log.V(2).Info("difference in StatefulSet container[0] name", "wanted", from.Spec.Template.Spec.Containers[0].Name, "existing", to.Spec.Template.Spec.Containers[0].Name)
-		requireUpdate = true
+// isStatefulSetClaim returns true if name is the name the StatefulSet controller gives the
+// claim created from template for a current pod of statefulset, i.e.
+// "<template>-<statefulset>-<ordinal>" with an ordinal within its replicas.
+func isStatefulSetClaim(name, template string, statefulset *appsv1.StatefulSet) bool {
+	suffix, ok := strings.CutPrefix(name, template+"-"+statefulset.Name+"-")
+	if !ok {
+		return false
 	}
-	to.Spec.Template.Spec.Containers[0].Name = from.Spec.Template.Spec.Containers[0].Name
-
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].Image, from.Spec.Template.Spec.Containers[0].Image) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] image change")
-		log.V(2).Info("difference in StatefulSet container[0] image", "wanted", from.Spec.Template.Spec.Containers[0].Image, "existing", to.Spec.Template.Spec.Containers[0].Image)
-		requireUpdate = true
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || strconv.Itoa(ordinal) != suffix {
+		return false
 	}
-	to.Spec.Template.Spec.Containers[0].Image = from.Spec.Template.Spec.Containers[0].Image
-
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].WorkingDir, from.Spec.Template.Spec.Containers[0].WorkingDir) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] working dir change")
-		log.V(2).Info("difference in StatefulSet container[0] working dir", "wanted", from.Spec.Template.Spec.Containers[0].WorkingDir, "existing", to.Spec.Template.Spec.Containers[0].WorkingDir)
-		requireUpdate = true
+	start, replicas := 0, 1
+	if statefulset.Spec.Ordinals != nil {
+		start = int(statefulset.Spec.Ordinals.Start)
 	}
-	to.Spec.Template.Spec.Containers[0].WorkingDir = from.Spec.Template.Spec.Containers[0].WorkingDir
-
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].Ports, from.Spec.Template.Spec.Containers[0].Ports) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] port change")
-		log.V(2).Info("difference in StatefulSet container[0] ports", "wanted", from.Spec.Template.Spec.Containers[0].Ports, "existing", to.Spec.Template.Spec.Containers[0].Ports)
-
-		requireUpdate = true
+	if statefulset.Spec.Replicas != nil {
+		replicas = int(*statefulset.Spec.Replicas)
 	}
-	to.Spec.Template.Spec.Containers[0].Ports = from.Spec.Template.Spec.Containers[0].Ports
+	return ordinal >= start && ordinal < start+replicas
+}
 
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].Env, from.Spec.Template.Spec.Containers[0].Env) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] env change")
-		log.V(2).Info("difference in StatefulSet container[0] env", "wanted", from.Spec.Template.Spec.Containers[0].Env, "existing", to.Spec.Template.Spec.Containers[0].Env)
-		requireUpdate = true
-	}
-	to.Spec.Template.Spec.Containers[0].Env = from.Spec.Template.Spec.Containers[0].Env
+// CopyStatefulSetFields copies the owned fields from one StatefulSet to another
+// Returns true if the fields copied from don't match to.
+func CopyStatefulSetFields(from, to *appsv1.StatefulSet, log logr.Logger) bool {
+	from = from.DeepCopy()
+	defaultStatefulSet(from)
 
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].EnvFrom, from.Spec.Template.Spec.Containers[0].EnvFrom) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] EnvFrom change")
-		log.V(2).Info("difference in StatefulSet container[0] EnvFrom", "wanted", from.Spec.Template.Spec.Containers[0].EnvFrom, "existing", to.Spec.Template.Spec.Containers[0].EnvFrom)
-		requireUpdate = true
-	}
-	to.Spec.Template.Spec.Containers[0].EnvFrom = from.Spec.Template.Spec.Containers[0].EnvFrom
+	requireUpdate := false
+	requireUpdate = copyField(log, "StatefulSet", "metadata.labels", &to.Labels, from.Labels) || requireUpdate
+	requireUpdate = copyAnnotations(log, "StatefulSet", &to.Annotations, from.Annotations) || requireUpdate
 
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].Resources, from.Spec.Template.Spec.Containers[0].Resources) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] resource change")
-		log.V(2).Info("difference in StatefulSet container[0] resources", "wanted", from.Spec.Template.Spec.Containers[0].Resources, "existing", to.Spec.Template.Spec.Containers[0].Resources)
-		requireUpdate = true
-	}
-	to.Spec.Template.Spec.Containers[0].Resources = from.Spec.Template.Spec.Containers[0].Resources
+	requireUpdate = copyField(log, "StatefulSet", "spec.replicas", &to.Spec.Replicas, from.Spec.Replicas) || requireUpdate
 
-	if !reflect.DeepEqual(to.Spec.Template.Spec.Containers[0].VolumeMounts, from.Spec.Template.Spec.Containers[0].VolumeMounts) {
-		log.V(1).Info("reconciling StatefulSet due to container[0] VolumeMounts change")
-		log.V(2).Info("difference in StatefulSet container[0] VolumeMounts", "wanted", from.Spec.Template.Spec.Containers[0].VolumeMounts, "existing", to.Spec.Template.Spec.Containers[0].VolumeMounts)
-		requireUpdate = true
-	}
-	to.Spec.Template.Spec.Containers[0].VolumeMounts = from.Spec.Template.Spec.Containers[0].VolumeMounts
+	requireUpdate = copyPodTemplate(log, "StatefulSet", "spec.template", &from.Spec.Template, &to.Spec.Template) || requireUpdate
 
 	return requireUpdate
 }
@@ -0,0 +1,410 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pluralsh/controller-reconcile-helper/pkg/conditions"
+	crhelpertypes "github.com/pluralsh/controller-reconcile-helper/pkg/types"
+)
+
+const (
+	// TLSCACertKey is the key of the CA bundle in a Secret reconciled by TLSSecret. It holds the
+	// certificate of the current CA and, after the CA was rotated, of the previous one until it expires.
+	TLSCACertKey = "ca.crt"
+	// TLSCAKeyKey is the key of the private key of the CA in a Secret reconciled by TLSSecret.
+	TLSCAKeyKey = "ca.key"
+)
+
+const (
+	// DefaultCAValidity is the validity of CAs generated by TLSSecret if none is set.
+	DefaultCAValidity = 10 * 365 * 24 * time.Hour
+	// DefaultCertificateValidity is the validity of certificates generated by TLSSecret if none is set.
+	DefaultCertificateValidity = 365 * 24 * time.Hour
+	// DefaultCertificateRotateBefore is how long before they expire certificates are rotated if not set.
+	DefaultCertificateRotateBefore = 30 * 24 * time.Hour
+)
+
+const (
+	// CertificateReasonMissing means the Secret did not contain a certificate yet.
+	CertificateReasonMissing = "Missing"
+	// CertificateReasonInvalid means the certificate, its key or its CA could not be parsed or verified.
+	CertificateReasonInvalid = "Invalid"
+	// CertificateReasonSubjectChanged means the common name or SANs of the certificate don't match.
+	CertificateReasonSubjectChanged = "SubjectChanged"
+	// CertificateReasonExpiring means the certificate expires within the rotation threshold.
+	CertificateReasonExpiring = "Expiring"
+	// CertificateReasonExpired means the certificate has expired.
+	CertificateReasonExpired = "Expired"
+)
+
+// Certificate describes a self-signed serving certificate reconciled by TLSSecret.
+type Certificate struct {
+	// CommonName is the common name of the certificate.
+	CommonName string
+
+	// DNSNames are the DNS subject alternative names, e.g. "my-webhook.my-namespace.svc".
+	DNSNames []string
+
+	// IPAddresses are the IP subject alternative names.
+	IPAddresses []net.IP
+
+	// Validity is how long generated certificates are valid, DefaultCertificateValidity if zero.
+	Validity time.Duration
+
+	// CAValidity is how long generated CAs are valid, DefaultCAValidity if zero. A CA is kept
+	// when the certificate is rotated, until a new certificate would outlive it, so it should
+	// be several times Validity. It is at least Validity.
+	CAValidity time.Duration
+
+	// RotateBefore is how long before it expires a certificate is rotated,
+	// DefaultCertificateRotateBefore if zero.
+	RotateBefore time.Duration
+}
+
+// CertificateStatus describes the certificate stored in a Secret reconciled by TLSSecret.
+type CertificateStatus struct {
+	// CABundle is the PEM encoded CA certificate, e.g. for the caBundle of a webhook configuration.
+	CABundle []byte
+
+	// NotAfter is the time the certificate expires.
+	NotAfter time.Time
+
+	// RenewAt is the time the certificate is rotated.
+	RenewAt time.Time
+
+	// Rotated is true if a new certificate was generated by the reconcile call.
+	Rotated bool
+
+	// CARotated is true if a new CA was generated by the reconcile call. Clients need the
+	// new CABundle to trust the certificate.
+	CARotated bool
+
+	// Reason is the reason a new certificate was generated, e.g. CertificateReasonExpiring.
+	Reason string
+
+	// Now is the time the certificate was checked at.
+	Now time.Time
+}
+
+// Condition returns a condition of type t reflecting the expiry of the certificate. It is true
+// while the certificate is valid and not due for rotation, false with Severity=Warning if it is
+// due for rotation and false with Severity=Error if it has expired. As a reconcile call rotates
+// a certificate that is due, only dry-run calls, which report the live certificate, return false.
+func (s CertificateStatus) Condition(t crhelpertypes.ConditionType) *crhelpertypes.Condition {
+	switch {
+	case !s.Now.Before(s.NotAfter):
+		return conditions.FalseCondition(t, CertificateReasonExpired, crhelpertypes.ConditionSeverityError, "certificate expired at %s", s.NotAfter.Format(time.RFC3339))
+	case !s.Now.Before(s.RenewAt):
+		return conditions.FalseCondition(t, CertificateReasonExpiring, crhelpertypes.ConditionSeverityWarning, "certificate expires at %s", s.NotAfter.Format(time.RFC3339))
+	default:
+		return conditions.TrueCondition(t)
+	}
+}
+
+// TLSSecretResult describes what a reconcile call did to a TLS Secret.
+type TLSSecretResult struct {
+	Result
+
+	// Certificate is the status of the certificate stored in the Secret.
+	Certificate CertificateStatus
+}
+
+// TLSSecret reconciles a kubernetes.io/tls Secret holding a serving certificate for cert signed
+// by a self-signed CA, whose certificate and key are stored under TLSCACertKey and TLSCAKeyKey.
+// The certificate stored in the live Secret is kept as long as it matches cert and is not due for
+// rotation, otherwise a new certificate is generated. It is signed by the live CA, so clients
+// keep trusting it, unless the CA would expire before the new certificate; then a new CA is
+// generated and the previous one is kept in the CA bundle until it expires. Result.RequeueAfter
+// is set to the time left until the next rotation. The data of secret is overwritten; WithClock
+// sets the clock the expiry is checked with.
+func TLSSecret(ctx context.Context, r client.Client, secret *corev1.Secret, cert Certificate, log logr.Logger, opts ...Option) (TLSSecretResult, error) {
+	o := newOptions(opts...)
+	now := o.now()
+	if cert.Validity == 0 {
+		cert.Validity = DefaultCertificateValidity
+	}
+	if cert.CAValidity == 0 {
+		cert.CAValidity = DefaultCAValidity
+	}
+	if cert.CAValidity < cert.Validity {
+		cert.CAValidity = cert.Validity
+	}
+	if cert.RotateBefore == 0 {
+		cert.RotateBefore = DefaultCertificateRotateBefore
+	}
+
+	secret.Type = corev1.SecretTypeTLS
+	var status CertificateStatus
+	result, err := Secret(ctx, r, secret, log, append(opts, withPrepare(func(ctx context.Context, r client.Client, desired, found client.Object) error {
+		var err error
+		status, err = prepareCertificate(desired.(*corev1.Secret), found, cert, now, o.dryRun, log)
+		return err
+	}))...)
+	if err != nil {
+		return TLSSecretResult{}, err
+	}
+
+	if result.RequeueAfter == 0 && status.RenewAt.After(now) {
+		result.RequeueAfter = status.RenewAt.Sub(now)
+	}
+	return TLSSecretResult{Result: result, Certificate: status}, nil
+}
+
+// prepareCertificate sets the data of desired to the certificate of the live Secret found if it
+// is still valid for cert at now, otherwise to a newly generated one. The status of a dry-run
+// call describes the live certificate, as it is not replaced.
+func prepareCertificate(desired *corev1.Secret, found client.Object, cert Certificate, now time.Time, dryRun bool, log logr.Logger) (CertificateStatus, error) {
+	reason := CertificateReasonMissing
+	var live map[string][]byte
+	var notAfter time.Time
+	if found != nil {
+		live = found.(*corev1.Secret).Data
+		notAfter, reason = checkCertificate(live, cert, now)
+		if reason == "" {
+			desired.Data = map[string][]byte{
+				corev1.TLSCertKey:       live[corev1.TLSCertKey],
+				corev1.TLSPrivateKeyKey: live[corev1.TLSPrivateKeyKey],
+				TLSCACertKey:            live[TLSCACertKey],
+			}
+			if caKey, ok := live[TLSCAKeyKey]; ok {
+				desired.Data[TLSCAKeyKey] = caKey
+			}
+			desired.StringData = nil
+			return CertificateStatus{CABundle: live[TLSCACertKey], NotAfter: notAfter, RenewAt: notAfter.Add(-cert.RotateBefore), Now: now}, nil
+		}
+	}
+
+	// Keep the live CA as long as it outlives the new certificate.
+	ca, caKey := liveCA(live, now.Add(cert.Validity))
+	caRotated := ca == nil
+	log.Info("Generating certificate", "namespace", desired.Namespace, "name", desired.Name, "reason", reason, "newCA", caRotated)
+	if caRotated {
+		var err error
+		if ca, caKey, err = generateCA(cert, now); err != nil {
+			return CertificateStatus{}, errors.Wrap(err, "unable to generate CA")
+		}
+	}
+	data, err := generateCertificate(cert, ca, caKey, now)
+	if err != nil {
+		return CertificateStatus{}, errors.Wrap(err, "unable to generate certificate")
+	}
+	data[TLSCACertKey] = caBundle(ca, live[TLSCACertKey], now)
+
+	desired.Data = data
+	desired.StringData = nil
+	status := CertificateStatus{Rotated: true, CARotated: caRotated, Reason: reason, Now: now}
+	if dryRun && !notAfter.IsZero() {
+		status.CABundle, status.NotAfter = live[TLSCACertKey], notAfter
+	} else {
+		status.CABundle, status.NotAfter = data[TLSCACertKey], now.Add(cert.Validity)
+	}
+	status.RenewAt = status.NotAfter.Add(-cert.RotateBefore)
+	return status, nil
+}
+
+// liveCA returns the CA stored in data if it is valid and does not expire before notAfter.
+func liveCA(data map[string][]byte, notAfter time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	if len(data[TLSCACertKey]) == 0 || len(data[TLSCAKeyKey]) == 0 {
+		return nil, nil
+	}
+	if _, err := tls.X509KeyPair(data[TLSCACertKey], data[TLSCAKeyKey]); err != nil {
+		return nil, nil
+	}
+	ca, err := parseCertificate(data[TLSCACertKey])
+	if err != nil || !ca.IsCA || ca.NotAfter.Before(notAfter) {
+		return nil, nil
+	}
+	block, _ := pem.Decode(data[TLSCAKeyKey])
+	if block == nil {
+		return nil, nil
+	}
+	caKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil
+	}
+	return ca, caKey
+}
+
+// caBundle returns the PEM encoded bundle of ca and the certificates of the previous bundle
+// that are not expired at now, so that clients trust certificates signed by either.
+func caBundle(ca *x509.Certificate, previous []byte, now time.Time) []byte {
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	for block, rest := pem.Decode(previous); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" || bytes.Equal(block.Bytes, ca.Raw) {
+			continue
+		}
+		if old, err := x509.ParseCertificate(block.Bytes); err != nil || !now.Before(old.NotAfter) {
+			continue
+		}
+		bundle = append(bundle, pem.EncodeToMemory(block)...)
+	}
+	return bundle
+}
+
+// checkCertificate returns the expiry of the certificate stored in data and, if it has to be
+// rotated, the reason why.
+func checkCertificate(data map[string][]byte, cert Certificate, now time.Time) (time.Time, string) {
+	if len(data[corev1.TLSCertKey]) == 0 || len(data[corev1.TLSPrivateKeyKey]) == 0 || len(data[TLSCACertKey]) == 0 {
+		return time.Time{}, CertificateReasonMissing
+	}
+	if _, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey]); err != nil {
+		return time.Time{}, CertificateReasonInvalid
+	}
+	leaf, err := parseCertificate(data[corev1.TLSCertKey])
+	if err != nil {
+		return time.Time{}, CertificateReasonInvalid
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data[TLSCACertKey]) {
+		return time.Time{}, CertificateReasonInvalid
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: now}); err != nil {
+		if !now.Before(leaf.NotAfter) {
+			return leaf.NotAfter, CertificateReasonExpired
+		}
+		return leaf.NotAfter, CertificateReasonInvalid
+	}
+
+	if leaf.Subject.CommonName != cert.CommonName || !equalStrings(leaf.DNSNames, cert.DNSNames) || !equalIPs(leaf.IPAddresses, cert.IPAddresses) {
+		return leaf.NotAfter, CertificateReasonSubjectChanged
+	}
+	if !now.Before(leaf.NotAfter.Add(-cert.RotateBefore)) {
+		return leaf.NotAfter, CertificateReasonExpiring
+	}
+	return leaf.NotAfter, ""
+}
+
+// generateCA generates a CA for cert valid from now for cert.CAValidity.
+func generateCA(cert Certificate, now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	caTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cert.CommonName + "-ca"},
+		NotBefore:             now,
+		NotAfter:              now.Add(cert.CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if caTemplate.SerialNumber, err = serialNumber(); err != nil {
+		return nil, nil, err
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, caKey, nil
+}
+
+// generateCertificate generates a certificate for cert signed by ca, valid from now for
+// cert.Validity. It returns the Secret data holding the certificate, its key and the key of
+// ca; the CA bundle is added by the caller.
+func generateCertificate(cert Certificate, ca *x509.Certificate, caKey *ecdsa.PrivateKey, now time.Time) (map[string][]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cert.CommonName},
+		DNSNames:    cert.DNSNames,
+		IPAddresses: cert.IPAddresses,
+		NotBefore:   now,
+		NotAfter:    now.Add(cert.Validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if template.SerialNumber, err = serialNumber(); err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		TLSCAKeyKey:             pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDER}),
+	}, nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// equalStrings returns true if a and b contain the same strings in any order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalIPs returns true if a and b contain the same IP addresses in any order.
+func equalIPs(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, ip := range a {
+		found := false
+		for _, other := range b {
+			if bytes.Equal(ip.To16(), other.To16()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
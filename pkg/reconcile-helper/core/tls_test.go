@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	crhelpertypes "github.com/pluralsh/controller-reconcile-helper/pkg/types"
+)
+
+func TestTLSSecretRotation(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cert := Certificate{
+		CommonName: "webhook",
+		DNSNames:   []string{"webhook.default.svc"},
+	}
+
+	tests := []struct {
+		name string
+		// existing creates the certificate at start before the checked call.
+		existing bool
+		// after is how long after start the checked call is made.
+		after  time.Duration
+		change func(cert *Certificate)
+		dryRun bool
+
+		reason    string
+		rotated   bool
+		caRotated bool
+		severity  crhelpertypes.ConditionSeverity
+	}{
+		{
+			name:      "Missing",
+			reason:    CertificateReasonMissing,
+			rotated:   true,
+			caRotated: true,
+		},
+		{
+			name:     "Unchanged",
+			existing: true,
+			after:    24 * time.Hour,
+		},
+		{
+			name:     "Expiring",
+			existing: true,
+			after:    DefaultCertificateValidity - DefaultCertificateRotateBefore,
+			reason:   CertificateReasonExpiring,
+			rotated:  true,
+		},
+		{
+			name:     "SubjectChanged",
+			existing: true,
+			after:    24 * time.Hour,
+			change: func(cert *Certificate) {
+				cert.DNSNames = append(cert.DNSNames, "webhook.default.svc.cluster.local")
+			},
+			reason:  CertificateReasonSubjectChanged,
+			rotated: true,
+		},
+		{
+			name:     "Expired",
+			existing: true,
+			after:    DefaultCertificateValidity + time.Hour,
+			reason:   CertificateReasonExpired,
+			rotated:  true,
+		},
+		{
+			name:      "CA expiring",
+			existing:  true,
+			after:     DefaultCAValidity - DefaultCertificateValidity + time.Hour,
+			reason:    CertificateReasonExpired,
+			rotated:   true,
+			caRotated: true,
+		},
+		{
+			name:     "Expiring dry-run",
+			existing: true,
+			after:    DefaultCertificateValidity - DefaultCertificateRotateBefore,
+			dryRun:   true,
+			reason:   CertificateReasonExpiring,
+			rotated:  true,
+			severity: crhelpertypes.ConditionSeverityWarning,
+		},
+		{
+			name:     "Expired dry-run",
+			existing: true,
+			after:    DefaultCertificateValidity + time.Hour,
+			dryRun:   true,
+			reason:   CertificateReasonExpired,
+			rotated:  true,
+			severity: crhelpertypes.ConditionSeverityError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := fake.NewClientBuilder().Build()
+			clock := clocktesting.NewFakeClock(start)
+			key := client.ObjectKey{Namespace: "default", Name: "webhook-tls"}
+
+			var before corev1.Secret
+			if tt.existing {
+				if _, err := TLSSecret(ctx, r, tlsSecret(key), cert, logr.Discard(), WithClock(clock)); err != nil {
+					t.Fatalf("creating certificate: %v", err)
+				}
+				if err := r.Get(ctx, key, &before); err != nil {
+					t.Fatalf("getting Secret: %v", err)
+				}
+			}
+
+			clock.SetTime(start.Add(tt.after))
+			want := cert
+			want.DNSNames = append([]string(nil), cert.DNSNames...)
+			if tt.change != nil {
+				tt.change(&want)
+			}
+			opts := []Option{WithClock(clock)}
+			if tt.dryRun {
+				opts = append(opts, WithDryRun())
+			}
+			result, err := TLSSecret(ctx, r, tlsSecret(key), want, logr.Discard(), opts...)
+			if err != nil {
+				t.Fatalf("TLSSecret() error = %v", err)
+			}
+			status := result.Certificate
+
+			if status.Reason != tt.reason || status.Rotated != tt.rotated || status.CARotated != tt.caRotated {
+				t.Errorf("TLSSecret() reason = %q, rotated = %t, CA rotated = %t, want %q, %t, %t",
+					status.Reason, status.Rotated, status.CARotated, tt.reason, tt.rotated, tt.caRotated)
+			}
+			if severity := status.Condition("Certificate").Severity; severity != tt.severity {
+				t.Errorf("Condition() severity = %q, want %q", severity, tt.severity)
+			}
+
+			var after corev1.Secret
+			if err := r.Get(ctx, key, &after); err != nil {
+				t.Fatalf("getting Secret: %v", err)
+			}
+			if !bytes.Equal(status.CABundle, after.Data[TLSCACertKey]) {
+				t.Errorf("CABundle does not match %s of the Secret", TLSCACertKey)
+			}
+			if notAfter, reason := checkCertificate(after.Data, want, start.Add(tt.after)); !tt.dryRun && reason != "" {
+				t.Errorf("certificate stored in the Secret has to be rotated: %s", reason)
+			} else if !notAfter.Equal(status.NotAfter) {
+				t.Errorf("NotAfter = %s, want %s of the stored certificate", status.NotAfter, notAfter)
+			}
+			if !tt.existing {
+				return
+			}
+
+			rotated := !bytes.Equal(before.Data[corev1.TLSCertKey], after.Data[corev1.TLSCertKey])
+			if rotated != (tt.rotated && !tt.dryRun) {
+				t.Errorf("stored certificate rotated = %t, want %t", rotated, tt.rotated && !tt.dryRun)
+			}
+			caRotated := !bytes.Equal(before.Data[TLSCAKeyKey], after.Data[TLSCAKeyKey])
+			if caRotated != (tt.caRotated && !tt.dryRun) {
+				t.Errorf("stored CA rotated = %t, want %t", caRotated, tt.caRotated && !tt.dryRun)
+			}
+			if caRotated {
+				// The previous CA is kept in the bundle until it expires.
+				if n := countCertificates(after.Data[TLSCACertKey]); n != 2 || !bytes.HasSuffix(after.Data[TLSCACertKey], before.Data[TLSCACertKey]) {
+					t.Errorf("%s holds %d certificates, want the new and the previous CA", TLSCACertKey, n)
+				}
+			} else if !bytes.Equal(before.Data[TLSCACertKey], after.Data[TLSCACertKey]) {
+				t.Errorf("%s changed although the CA was kept", TLSCACertKey)
+			}
+		})
+	}
+}
+
+func tlsSecret(key client.ObjectKey) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+}
+
+// countCertificates returns the number of PEM encoded certificates in data.
+func countCertificates(data []byte) int {
+	n := 0
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			n++
+		}
+	}
+	return n
+}